@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The type of the PEM block --armor writes the signature in.
+const signatureBlockType = "SIGNATURE"
+
+// The headers of a SIGNATURE block, naming the curve of the key and the hash
+// the signature was made with.  Ed25519 signatures have no Hash header.
+const (
+	curveHeader = "Curve"
+	hashHeader  = "Hash"
+)
+
+// The armorSignature function takes in an ASN.1 DER signature, the public key
+// it verifies under and the name of the hash it was made with, and returns the
+// signature as a PEM SIGNATURE block with Curve and Hash headers, for verifiers
+// that want a block to copy and paste rather than Base64 in JSON.
+func armorSignature(sign []byte, pubKey crypto.PublicKey, hash string) string {
+	headers := map[string]string{curveHeader: signer.KeyCurve(pubKey)}
+	if signer.KeyAlgorithm(pubKey) == signer.AlgoECDSA {
+		headers[hashHeader] = signer.HashName(hash)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: signatureBlockType, Headers: headers, Bytes: sign}))
+}
+
+// The signatureArmored function takes in the same arguments as sign and
+// returns the signature of the input as a PEM SIGNATURE block, as --armor
+// writes it, or an error if there is one.
+func signatureArmored(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	out, err := signer.Sign(input, privKey, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// --armor is only allowed with the default signature format, so the
+	// signature is Base64 encoded DER.
+	sign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return "", err
+	}
+
+	return armorSignature(sign, privKey.Public(), opts.Hash), nil
+}
+
+// The decodeSignatureText function takes in a signature as a verifier is given
+// it, either Base64 encoded or as a PEM SIGNATURE block written by --armor, and
+// the name of the hash the verifier checks it with.  It returns the DER
+// signature, or an error if it can not be decoded or the block says it was made
+// with another hash.
+func decodeSignatureText(text, hash string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "-----BEGIN ") {
+		sign, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("signature is not Base64 encoded: %v", err)
+		}
+		return sign, nil
+	}
+
+	block, rest := pem.Decode([]byte(text))
+	if block == nil || block.Type != signatureBlockType {
+		return nil, errors.New("signature is not a PEM encoded SIGNATURE block")
+	}
+	if len(strings.TrimSpace(string(rest))) != 0 {
+		return nil, errors.New("signature has data after the SIGNATURE block")
+	}
+
+	if blockHash, ok := block.Headers[hashHeader]; ok && blockHash != signer.HashName(hash) {
+		return nil, fmt.Errorf("signature was made with %s, not %s", blockHash, signer.HashName(hash))
+	}
+
+	return block.Bytes, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestArmor(t *testing.T) {
+	privKey, pubKey := keyContents()
+	opts := signer.Options{Hash: "sha384"}
+
+	armored, err := signatureArmored("Hello", privKey, opts)
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+	if !strings.HasPrefix(armored, "-----BEGIN SIGNATURE-----\nCurve: P-521\nHash: sha384\n") {
+		t.Errorf("The armored signature does not start with its headers:\n%s", armored)
+	}
+
+	valid, err := verifyFromPEM(pubKey, "Hello", armored, opts)
+	if err != nil || !valid {
+		t.Errorf("The armored signature does not verify: %v", err)
+	}
+	if valid, _ := verifyFromPEM(pubKey, "Goodbye", armored, opts); valid {
+		t.Error("The armored signature verifies another message.")
+	}
+
+	if _, err := decodeSignatureText(armored, "sha256"); err == nil {
+		t.Error("An armored sha384 signature was accepted as a sha256 one.")
+	}
+
+	tests := map[string]string{
+		"wrong type": strings.Replace(armored, "SIGNATURE", "PUBLIC KEY", 2),
+		"trailing":   armored + "extra",
+		"corrupt":    armored[:len(armored)/2],
+	}
+	for name, text := range tests {
+		if _, err := decodeSignatureText(text, "sha384"); err == nil {
+			t.Errorf("The %s armored signature was accepted.", name)
+		}
+	}
+}
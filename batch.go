@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The batch flag signs every line read from standard in, loading the key pair
+// only once, and prints the results as a JSON array.
+var batch = flag.Bool("batch", false, "sign each line of standard in as its own message and print a JSON array")
+
+// The failFast flag makes --batch stop at the first line that can not be
+// signed, and --message-file-list at the first file, instead of reporting it
+// and going on.
+var failFast = flag.Bool("fail-fast", false, "with --batch or --message-file-list, stop at the first line or file that can not be signed")
+
+// The signBatch function takes in a reader holding one message per line, the
+// private key, the signer.Options, whether to stop at the first bad line, and a
+// writer for reporting bad lines.  It signs each line within the --max-len
+// limit, and not empty unless --allow-empty is given, as sign does and returns
+// a JSON array of the output of every line that was signed, in order, and the
+// number of lines that were not.  A bad line is
+// reported to the writer with its line number, counting from 1.  It returns an
+// error if the reader fails, or for the first bad line if failFast is true.
+func signBatch(r io.Reader, privKey crypto.Signer, opts signer.Options, failFast bool, report io.Writer) (string, int, error) {
+	outputs := []signer.Output{}
+	failed := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxFileSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		// Lines may end in "\r\n" as well as "\n".
+		input := strings.TrimSuffix(scanner.Text(), "\r")
+
+		var out signer.Output
+		err := withCode(errCodeArgs, checkLength(input))
+		if err == nil {
+			err = withCode(errCodeArgs, checkEmpty(input))
+		}
+		if err == nil {
+			out, err = signer.Sign(input, privKey, opts)
+		}
+
+		if err != nil {
+			if failFast {
+				return "", failed + 1, fmt.Errorf("line %d: %w", line, err)
+			}
+			fmt.Fprintf(report, "line %d: %v\n", line, err)
+			failed++
+			continue
+		}
+
+		outputs = append(outputs, out)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", failed, err
+	}
+
+	outJSON, err := marshalJSON(outputs)
+	if err != nil {
+		return "", failed, err
+	}
+
+	return string(outJSON), failed, nil
+}
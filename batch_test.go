@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestSignBatch(t *testing.T) {
+	privKey, _ := keyContents()
+	lines := "Hello\r\n" + strings.Repeat("a", *maxLen+1) + "\nGoodbye\n"
+
+	var report bytes.Buffer
+	signed, failed, err := signBatch(strings.NewReader(lines), privKey, signer.Options{}, false, &report)
+	if err != nil {
+		t.Fatalf("Error signing batch: %v", err)
+	}
+
+	if failed != 1 || !strings.HasPrefix(report.String(), "line 2: ") {
+		t.Errorf("%d lines failed with report %q, expected line 2 only.", failed, report.String())
+	}
+
+	var outs []signer.Output
+
+	err = json.Unmarshal([]byte(signed), &outs)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if len(outs) != 2 || outs[0].Message != "Hello" || outs[1].Message != "Goodbye" {
+		t.Fatalf("Signed %+v, expected Hello and Goodbye.", outs)
+	}
+
+	for _, out := range outs {
+		valid, err := signer.Verify(marshalOutput(t, out), nil, signer.Options{})
+		if err != nil || !valid {
+			t.Errorf("The batch signature of %q does not verify: %v", out.Message, err)
+		}
+	}
+
+	_, _, err = signBatch(strings.NewReader(lines), privKey, signer.Options{}, true, &report)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("Fail fast gave %v, expected an error for line 2.", err)
+	}
+}
+
+func marshalOutput(t *testing.T, out signer.Output) []byte {
+	outJSON, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("Error marshaling json: %v", err)
+	}
+	return outJSON
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// This is the path, under the home directory, of the config file that sets
+// defaults for the flags.
+var configFile = filepath.Join(".config", "signer", "config.json")
+
+// The config struct holds the defaults read from the config file.  Empty
+// fields leave the built-in defaults as they are.
+type config struct {
+	Keyfile     string `json:"keyfile"`
+	Algo        string `json:"algo"`
+	Curve       string `json:"curve"`
+	Hash        string `json:"hash"`
+	SigFormat   string `json:"sig_format"`
+	SigEncoding string `json:"sig_encoding"`
+}
+
+// The configKeyfile is the path of the key pair file from the config file.  It
+// comes after the --keyfile flag and the keyfileEnv environment variable, so
+// it is kept apart from the flag.
+var configKeyfile string
+
+// The loadConfig function takes in the path of the config file and returns the
+// defaults it sets, none if there is no file, or an error if it can not be read
+// or is not JSON with only the known fields.
+func loadConfig(filePath string) (config, error) {
+	var cfg config
+
+	contents, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	// A misspelled field would otherwise be ignored without a word.
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, withCode(errCodeParse, fmt.Errorf("config file %s: %v", filePath, err))
+	}
+
+	return cfg, nil
+}
+
+// The applyConfig function takes in the flag set of the command being run,
+// before its flags are parsed.  It makes each default the config file has the
+// default of its flag, so a flag given on the command line still wins and one
+// that is not does not count as given, and keeps the path of the key pair file
+// in configKeyfile.  Without a home
+// directory or a config file nothing changes.  It exits the program if the
+// config file is malformed.
+func applyConfig(flags *flag.FlagSet) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+
+	cfg, err := loadConfig(filepath.Join(home, configFile))
+	checkError(err)
+
+	configKeyfile = cfg.Keyfile
+
+	defaults := map[string]string{
+		"algo":         cfg.Algo,
+		"curve":        cfg.Curve,
+		"hash":         cfg.Hash,
+		"sig-format":   cfg.SigFormat,
+		"sig-encoding": cfg.SigEncoding,
+	}
+	for name, value := range defaults {
+		f := flags.Lookup(name)
+		if value == "" || f == nil {
+			continue
+		}
+
+		// Setting the value through the flag set would mark the flag as
+		// given on the command line.
+		checkError(f.Value.Set(value))
+		f.DefValue = value
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(keyfileEnv, "")
+	defer func() { configKeyfile = "" }()
+
+	newFlags := func() (*flag.FlagSet, *string, *string) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		curve := flags.String("curve", "", "")
+		hash := flags.String("hash", "sha256", "")
+		return flags, curve, hash
+	}
+
+	// Without a config file the built-in defaults are kept.
+	flags, curve, hash := newFlags()
+	applyConfig(flags)
+	if *curve != "" || *hash != "sha256" || configKeyfile != "" {
+		t.Errorf("Without a config file the defaults became curve %q, hash %q, keyfile %q.", *curve, *hash, configKeyfile)
+	}
+
+	configPath := path.Join(home, configFile)
+	if err := os.MkdirAll(path.Dir(configPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	contents := `{"curve": "p256", "hash": "sha384", "keyfile": "/config/keypair.txt", "sig_format": "rawhex"}`
+	if err := os.WriteFile(configPath, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A flag on the command line wins over the config file.
+	flags, curve, hash = newFlags()
+	applyConfig(flags)
+	if err := flags.Parse([]string{"--hash", "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+	if *curve != "p256" || *hash != "sha512" {
+		t.Errorf("The config file and flags gave curve %q and hash %q, expected p256 and sha512.", *curve, *hash)
+	}
+
+	// The environment wins over the config file, and the config file over the
+	// default path.
+	if p, _ := plannedKeyfilePath(); p != "/config/keypair.txt" {
+		t.Errorf("Key pair file is %s, expected the one in the config file.", p)
+	}
+	t.Setenv(keyfileEnv, "/env/keypair.txt")
+	if p, _ := plannedKeyfilePath(); p != "/env/keypair.txt" {
+		t.Errorf("Key pair file is %s, expected the one in the environment.", p)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"curv": "p256"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "curv") {
+		t.Errorf("A misspelled field gave %v, expected it to be named.", err)
+	}
+}
+
+func TestApplyConfigNotPassed(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	configPath := path.Join(home, configFile)
+	if err := os.MkdirAll(path.Dir(configPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte(`{"hash": "sha256"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := flag.CommandLine
+	defer func() { flag.CommandLine = saved }()
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	hash := flag.String("hash", "", "")
+	flag.Bool("jose-parts", false, "")
+
+	applyConfig(flag.CommandLine)
+	if err := flag.CommandLine.Parse([]string{"--jose-parts", "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// --jose-parts refuses a --hash given on the command line, not one from
+	// the config file.
+	if *hash != "sha256" {
+		t.Errorf("The hash is %q, expected the sha256 of the config file.", *hash)
+	}
+	if flagPassed("hash") {
+		t.Error("The hash of the config file counts as given on the command line.")
+	}
+	if !flagPassed("jose-parts") {
+		t.Error("--jose-parts does not count as given on the command line.")
+	}
+}
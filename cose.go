@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The cose flag makes the tool print a COSE_Sign1 structure, CBOR encoded,
+// instead of the JSON, for devices that parse CBOR rather than JSON.
+var cose = flag.Bool("cose", false, "print a CBOR encoded COSE_Sign1 structure instead of JSON")
+
+// The COSE algorithm identifiers of RFC 9053 for each JWS algorithm, which
+// sign the same way: ES256 is -7, ES384 is -35, ES512 is -36 and EdDSA is -8.
+var coseAlgorithms = map[string]int64{
+	"ES256": -7,
+	"ES384": -35,
+	"ES512": -36,
+	"EdDSA": -8,
+}
+
+// The tag of a COSE_Sign1 structure, and the key of the algorithm in a COSE
+// header map.
+const (
+	coseSign1Tag = 18
+	coseAlgLabel = 1
+)
+
+// The coseSign function takes in the input as a string, the private key and the
+// signer.Options, and returns a COSE_Sign1 structure of the input as RFC 9052
+// lays it out: the protected header holding the algorithm, an empty
+// unprotected header, the payload and the signature, CBOR encoded and written
+// in the encoding of --sig-encoding, Base64 by default.  The hash is the one
+// the algorithm requires, as for a JWS, and the ECDSA signature is raw r||s.
+// It returns an error if there is one.
+func coseSign(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	jwsAlg, hash, err := jwsAlgorithm(privKey.Public())
+	if err != nil {
+		return "", err
+	}
+	opts.Hash = hash
+
+	// A hex or Base64 input is carried as the bytes it encodes.
+	payload, err := signer.DecodeMessage(input, opts.InputEncoding)
+	if err != nil {
+		return "", err
+	}
+
+	// The protected header is itself CBOR, carried as a byte string.
+	protected := cborMapHead(1)
+	protected = append(protected, cborInt(coseAlgLabel)...)
+	protected = append(protected, cborInt(coseAlgorithms[jwsAlg])...)
+
+	sign, err := signer.SignMessage(privKey, coseSigStructure(protected, []byte(payload)), opts)
+	if err != nil {
+		return "", err
+	}
+
+	rawSign, err := signer.RawSignature(sign, privKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	var b []byte
+	b = append(b, cborHead(cborTag, coseSign1Tag)...)
+	b = append(b, cborArrayHead(4)...)
+	b = append(b, cborBytes(protected)...)
+	b = append(b, cborMapHead(0)...)
+	b = append(b, cborBytes([]byte(payload))...)
+	b = append(b, cborBytes(rawSign)...)
+
+	switch signer.SigEncodingName("", opts.SigEncoding) {
+	case signer.SigEncodingHex:
+		return hex.EncodeToString(b), nil
+	case signer.SigEncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	default:
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+}
+
+// The coseSigStructure function takes in the encoded protected header and the
+// payload, and returns the bytes a COSE_Sign1 signature is made over: the
+// CBOR array of the text "Signature1", the protected header, empty external
+// data and the payload.
+func coseSigStructure(protected, payload []byte) string {
+	var b []byte
+	b = append(b, cborArrayHead(4)...)
+	b = append(b, cborText("Signature1")...)
+	b = append(b, cborBytes(protected)...)
+	b = append(b, cborBytes(nil)...)
+	b = append(b, cborBytes(payload)...)
+	return string(b)
+}
+
+// The CBOR major types used here, in the top three bits of the first byte.
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborByteStr  = 2 << 5
+	cborTextStr  = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+	cborTag      = 6 << 5
+)
+
+// The cborHead function takes in a CBOR major type and a number and returns the
+// head of a CBOR item: the number in the fewest bytes, as RFC 8949 asks of
+// deterministic encoding.
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n <= 0xff:
+		return []byte{major | 24, byte(n)}
+	case n <= 0xffff:
+		return []byte{major | 25, byte(n >> 8), byte(n)}
+	case n <= 0xffffffff:
+		return []byte{major | 26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	default:
+		return []byte{major | 27, byte(n >> 56), byte(n >> 48), byte(n >> 40), byte(n >> 32),
+			byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+}
+
+// The cborInt function takes in an integer and returns it CBOR encoded.
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(cborNegative, uint64(-1-n))
+	}
+	return cborHead(cborUnsigned, uint64(n))
+}
+
+// The cborBytes function takes in a slice of bytes and returns it CBOR encoded
+// as a byte string.
+func cborBytes(b []byte) []byte {
+	return append(cborHead(cborByteStr, uint64(len(b))), b...)
+}
+
+// The cborText function takes in a string and returns it CBOR encoded as a text
+// string.
+func cborText(s string) []byte {
+	return append(cborHead(cborTextStr, uint64(len(s))), s...)
+}
+
+// The cborArrayHead and cborMapHead functions take in the number of items, or
+// of key and value pairs, and return the head of a CBOR array or map.  The
+// items follow the head.
+func cborArrayHead(n int) []byte { return cborHead(cborArray, uint64(n)) }
+func cborMapHead(n int) []byte   { return cborHead(cborMap, uint64(n)) }
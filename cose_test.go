@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestCOSE(t *testing.T) {
+	privKey, _ := keyContents()
+
+	encoded, err := coseSign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing COSE_Sign1: %v", err)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("The COSE_Sign1 is not Base64 encoded: %v", err)
+	}
+
+	// Tag 18, an array of 4, the protected header {1: -36} (ES512) as a byte
+	// string, the empty unprotected header and the payload.
+	protected := []byte{0xa1, 0x01, 0x38, 0x23}
+	prefix := []byte{0xd2, 0x84, 0x44}
+	prefix = append(prefix, protected...)
+	prefix = append(prefix, 0xa0, 0x45, 'H', 'e', 'l', 'l', 'o')
+	if !bytes.HasPrefix(b, prefix) {
+		t.Fatalf("The COSE_Sign1 starts % x, expected % x.", b[:len(prefix)], prefix)
+	}
+
+	// The signature is a 132 byte string, raw r||s for P-521.
+	rest := b[len(prefix):]
+	if len(rest) != 2+132 || rest[0] != 0x58 || rest[1] != 132 {
+		t.Fatalf("The COSE_Sign1 signature is % x, expected a 132 byte string.", rest)
+	}
+
+	der, err := signer.DecodeSignature(hex.EncodeToString(rest[2:]), &privKey.PublicKey, signer.SigFormatRawHex, "")
+	if err != nil {
+		t.Fatalf("Error decoding COSE_Sign1 signature: %v", err)
+	}
+
+	// The Sig_structure is signed as it is, not framed as a preimage.
+	digest := sha512.Sum512([]byte(coseSigStructure(protected, []byte("Hello"))))
+	if !signer.VerifyHashed(&privKey.PublicKey, digest[:], der) {
+		t.Error("The COSE_Sign1 signature does not verify with SHA512.")
+	}
+
+	hexed, err := coseSign("Hello", privKey, signer.Options{SigEncoding: signer.SigEncodingHex})
+	if err != nil {
+		t.Fatalf("Error signing COSE_Sign1: %v", err)
+	}
+	if b, err := hex.DecodeString(hexed); err != nil || !bytes.HasPrefix(b, prefix) {
+		t.Errorf("The hex COSE_Sign1 does not decode to the structure: %v", err)
+	}
+}
+
+func TestCBORHead(t *testing.T) {
+	cases := []struct {
+		n    int64
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{256, "190100"},
+		{-1, "20"},
+		{-36, "3823"},
+		{-500, "3901f3"},
+	}
+
+	for _, c := range cases {
+		if got := hex.EncodeToString(cborInt(c.n)); got != c.want {
+			t.Errorf("%d is encoded as %s, expected %s.", c.n, got, c.want)
+		}
+	}
+}
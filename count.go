@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto"
+	"flag"
+	"fmt"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The count flag signs the message several times, each time with a new random
+// salt, and prints the results as a JSON array.
+var count = flag.Int("count", 0, fmt.Sprintf("sign the message this many times, each with a new random salt, up to %d, and print a JSON array", maxCount))
+
+// maxCount is the most signatures --count makes in one run.
+const maxCount = 1000
+
+// The signCount function takes in a message, the private key, the
+// signer.Options and the number of signatures to make.  It signs the message
+// that many times as sign does, each time with a new random salt in the
+// options, and returns a JSON array of the outputs, each with its salt, or an
+// error if there is one.
+func signCount(input string, privKey crypto.Signer, opts signer.Options, n int) (string, error) {
+	if n < 1 || n > maxCount {
+		return "", fmt.Errorf("--count must be between 1 and %d", maxCount)
+	}
+
+	outputs := make([]signer.Output, 0, n)
+	for i := 0; i < n; i++ {
+		salt, err := signer.NewSalt()
+		if err != nil {
+			return "", err
+		}
+		opts.Salt = salt
+
+		out, err := signer.Sign(input, privKey, opts)
+		if err != nil {
+			return "", err
+		}
+
+		outputs = append(outputs, out)
+	}
+
+	outJSON, err := marshalJSON(outputs)
+	if err != nil {
+		return "", err
+	}
+
+	return string(outJSON), nil
+}
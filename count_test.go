@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestSignCount(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := signCount("Hello", privKey, signer.Options{Deterministic: true}, 3)
+	if err != nil {
+		t.Fatalf("Error signing the message 3 times: %v", err)
+	}
+
+	var outs []signer.Output
+
+	err = json.Unmarshal([]byte(signed), &outs)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+	if len(outs) != 3 {
+		t.Fatalf("Made %d signatures, expected 3.", len(outs))
+	}
+
+	salts := map[string]bool{}
+	signatures := map[string]bool{}
+	for _, out := range outs {
+		if len(out.Salt) != 2*signer.SaltSize {
+			t.Errorf("The salt %q is not %d hex characters.", out.Salt, 2*signer.SaltSize)
+		}
+		salts[out.Salt] = true
+		signatures[out.Signature] = true
+
+		valid, err := signer.Verify(marshalOutput(t, out), nil, signer.Options{})
+		if err != nil || !valid {
+			t.Errorf("The signature with salt %s does not verify: %v", out.Salt, err)
+		}
+
+		// The salt is signed, so another one does not verify.
+		out.Salt = outs[0].Salt
+		if out.Signature != outs[0].Signature {
+			if valid, _ := signer.Verify(marshalOutput(t, out), nil, signer.Options{}); valid {
+				t.Error("A signature verified with the salt of another.")
+			}
+		}
+	}
+
+	// Even deterministic signatures differ, because the salts do.
+	if len(salts) != 3 || len(signatures) != 3 {
+		t.Errorf("Made %d salts and %d signatures, expected 3 of each.", len(salts), len(signatures))
+	}
+
+	for _, n := range []int{0, maxCount + 1} {
+		if _, err := signCount("Hello", privKey, signer.Options{}, n); err == nil {
+			t.Errorf("A count of %d was accepted.", n)
+		}
+	}
+}
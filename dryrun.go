@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The dryRun flag reports which key pair would be used, or created, without
+// writing anything or signing.
+var dryRun = flag.Bool("dry-run", false, "report the key pair that would be used or created, without writing anything or signing")
+
+// The dryRunPlan function takes in the file path of the key pair file and the
+// signer.KeyOptions a run would use, and returns what the run would do with the
+// key pair: the fingerprint of the key pair it would load, or the path and
+// kind of the key pair it would create.  Nothing is written and no passphrase
+// is asked for.  It returns an error if the options are bad or the file can
+// not be read.
+func dryRunPlan(filePath string, opts signer.KeyOptions) (string, error) {
+	exists, err := opts.HasKeyPair(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	name := ""
+	if opts.Identity != "" {
+		name = fmt.Sprintf(" %q", opts.Identity)
+	}
+
+	if !exists {
+		if err := signer.CheckIdentity(opts.Identity); err != nil {
+			return "", err
+		}
+
+		// The key is made only to check and describe the options, it is never
+		// saved.
+		privKey, err := signer.GenerateKey(opts.Algorithm, opts.Curve)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Would create key pair%s in keyfile at %s using %s",
+			name, filePath, signer.KeyDescription(privKey.Public())), nil
+	}
+
+	// The public keys are read rather than the private key, which may need a
+	// passphrase.
+	identities, err := opts.ListIdentities(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, id := range identities {
+		if id.Name != opts.Identity {
+			continue
+		}
+
+		fp, err := signer.Fingerprint(id.PublicKey)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Would use key pair%s in keyfile at %s, %s, fingerprint %s",
+			name, filePath, signer.KeyDescription(id.PublicKey), fp), nil
+	}
+
+	return "", fmt.Errorf("keyfile %s exists but has no public key to report", filePath)
+}
+
+// The dryRunKey function takes in the path of a private key given with --key
+// and returns the fingerprint of the key a run would sign with, or an error if
+// it can not be loaded.  The file is only read.
+func dryRunKey(keyPath string) (string, error) {
+	privKey, _, err := keyOptions("").LoadPrivateKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	fp, err := signer.Fingerprint(privKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Would use the private key in %s, %s, fingerprint %s",
+		keyPath, signer.KeyDescription(privKey.Public()), fp), nil
+}
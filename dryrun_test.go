@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestDryRunPlan(t *testing.T) {
+	dir := path.Join(t.TempDir(), "signer")
+	filePath := path.Join(dir, "keypair.txt")
+
+	plan, err := dryRunPlan(filePath, signer.KeyOptions{})
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if plan != "Would create key pair in keyfile at "+filePath+" using ECDSA P-521" {
+		t.Errorf("Unexpected plan for a missing keyfile: %s", plan)
+	}
+
+	// Nothing is written, not even the directory.
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("The dry run created %s: %v", dir, err)
+	}
+
+	if _, err := dryRunPlan(filePath, signer.KeyOptions{Curve: "p999"}); err == nil {
+		t.Error("An unknown curve did not return an error.")
+	}
+
+	err = os.Mkdir(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, _, err := signer.KeyOptions{Curve: "p256"}.Create(filePath)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	fp, err := signer.Fingerprint(privKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = dryRunPlan(filePath, signer.KeyOptions{})
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if !strings.HasPrefix(plan, "Would use") || !strings.HasSuffix(plan, "fingerprint "+fp) {
+		t.Errorf("Unexpected plan for an existing keyfile: %s", plan)
+	}
+
+	plan, err = dryRunPlan(filePath, signer.KeyOptions{Identity: "work", Algorithm: signer.AlgoEd25519})
+	if err != nil {
+		t.Fatalf("Error planning: %v", err)
+	}
+	if plan != `Would create key pair "work" in keyfile at `+filePath+" using Ed25519" {
+		t.Errorf("Unexpected plan for a missing identity: %s", plan)
+	}
+}
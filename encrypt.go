@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The encryptKey flag makes a newly created private key be saved encrypted with
+// a passphrase.  Keys that are already encrypted are decrypted whether or not
+// it is given.
+var encryptKey = flag.Bool("encrypt", false, "encrypt a newly created private key with a passphrase")
+
+// The environment variable that can hold the passphrase of an encrypted private
+// key, so scripts do not have to answer a prompt.
+const passphraseEnv = "SIGNER_PASSPHRASE"
+
+// The readPassphrase function takes in whether the passphrase is being chosen
+// rather than entered, and returns the passphrase from the passphraseEnv
+// environment variable if it is set.  Otherwise it asks for it on standard
+// error and reads it from standard in, with the echo of the terminal turned
+// off, twice when it is being chosen, exiting cleanly on Ctrl-C.  It returns
+// an error if standard in is not a terminal or the passphrase is empty.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase, ok := os.LookupEnv(passphraseEnv); ok {
+		if passphrase == "" {
+			return "", fmt.Errorf("%s is set but empty", passphraseEnv)
+		}
+		return passphrase, nil
+	}
+
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("the private key needs a passphrase, set %s", passphraseEnv)
+	}
+
+	// What is typed is not shown, and Ctrl-C at the prompt must neither
+	// leave the lock file of the key pair behind nor the echo turned off.
+	restore, err := hideInput(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	stop := catchInterrupt(restore)
+	defer stop()
+
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := readHiddenLine(reader)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("the passphrase can not be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Passphrase again: ")
+		again, err := readHiddenLine(reader)
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("the passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// The readHiddenLine function takes in a reader on a terminal whose echo is
+// turned off and returns the next line from it as readLine does.  The newline
+// typed at the end is not shown either, so it writes one to standard error for
+// whatever comes next.
+func readHiddenLine(reader *bufio.Reader) (string, error) {
+	line, err := readLine(reader)
+	fmt.Fprintln(os.Stderr)
+	return line, err
+}
+
+// The readLine function takes in a reader and returns the next line from it
+// without its line ending, or an error if there is one.
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestEncryptedKey(t *testing.T) {
+	filePath := path.Join(t.TempDir(), keyfile)
+	t.Setenv(passphraseEnv, "correct horse battery staple")
+
+	*encryptKey = true
+	privKey, pubKey, _, err := createSaveKey(filePath, signer.AlgoECDSA, rand.Reader)
+	*encryptKey = false
+	if err != nil {
+		t.Fatalf("Error creating encrypted key: %v", err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(contents), "-----BEGIN "+signer.EncryptedKeyType+"-----") {
+		t.Error("The private key was not saved encrypted.")
+	}
+
+	loaded, loadedPub, err := useKey(filePath)
+	if err != nil {
+		t.Fatalf("Error loading encrypted key: %v", err)
+	}
+	if loadedPub != pubKey || !signer.SameKey(loaded.Public(), privKey.Public()) {
+		t.Error("The decrypted key does not match the saved one.")
+	}
+
+	t.Setenv(passphraseEnv, "wrong passphrase")
+	_, _, err = useKey(filePath)
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("A wrong passphrase gave %v, expected a wrong passphrase error.", err)
+	}
+}
+
+func TestEncryptedKeyIterations(t *testing.T) {
+	privKey, _ := keyContents()
+
+	block, err := signer.EncryptPrivateKey(privKey, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A keyfile can not make decrypting it take as long as it likes.
+	for _, iterations := range []string{"0", "-1", "many", "6000001"} {
+		block.Headers["Iterations"] = iterations
+		if _, err := signer.DecryptPrivateKey(block, "correct horse battery staple"); err == nil || !strings.Contains(err.Error(), "iterations") {
+			t.Errorf("%s KDF iterations gave %v, expected an iterations error.", iterations, err)
+		}
+	}
+}
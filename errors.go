@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// The jsonErrors flag makes errors be written to standard error as JSON with a
+// stable code, for scripts that need to tell kinds of failure apart.
+var jsonErrors = flag.Bool("json-errors", false, `write errors to standard error as JSON: {"error":"...","code":"..."}`)
+
+// The error codes written with --json-errors.  They are part of the interface
+// of the tool, so existing codes must not change.
+const (
+	// errCodeIO is a file that can not be read or written.
+	errCodeIO = "io"
+	// errCodeParse is input, a key, or a keyfile that is malformed.
+	errCodeParse = "parse"
+	// errCodeSign is a failure to create a key or a signature.
+	errCodeSign = "sign"
+	// errCodeArgs is a bad or conflicting command line.
+	errCodeArgs = "args"
+)
+
+// The codedError struct holds an error together with the code --json-errors
+// reports it under.
+type codedError struct {
+	Code string
+	Err  error
+}
+
+func (e *codedError) Error() string { return e.Err.Error() }
+
+func (e *codedError) Unwrap() error { return e.Err }
+
+// The withCode function takes in an error code and an error and returns the
+// error marked with the code, or nil if the error is nil.  An error that is
+// already marked keeps the code it has, since that code is the more specific.
+func withCode(code string, err error) error {
+	var coded *codedError
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+	return &codedError{Code: code, Err: err}
+}
+
+// The errorCode function takes in an error and returns its code: the one it
+// was marked with by withCode, otherwise errCodeIO for errors about a file and
+// errCodeParse for anything else.
+func errorCode(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return errCodeIO
+	}
+
+	return errCodeParse
+}
+
+// The jsonError struct holds the JSON written for an error with --json-errors.
+type jsonError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// The writeJSONError function takes in a writer, an error code and a message
+// and writes the message and code to the writer as one line of JSON.
+func writeJSONError(w io.Writer, code, message string) {
+	json.NewEncoder(w).Encode(jsonError{Error: message, Code: code})
+}
+
+// The usageError function takes in a format and arguments as fmt.Printf does,
+// logs the message explaining what is wrong with the command line at the error
+// level, and exits the program with the exitError code.  With --json-errors the
+// message is written to standard error as JSON with the errCodeArgs code
+// instead.
+func usageError(format string, a ...interface{}) {
+	if *jsonErrors {
+		writeJSONError(os.Stderr, errCodeArgs, fmt.Sprintf(format, a...))
+		os.Exit(exitError)
+	}
+
+	logf(levelError, format, a...)
+	os.Exit(exitError)
+}
+
+// The checkError function takes in an error and checks if it is not equal to
+// nil, and if it is not then it logs the error at the error level and exits the
+// program with the exitError code, so an error is never mistaken for a
+// signature that does not verify.  With --json-errors the error is written to
+// standard error as JSON with its code instead.
+func checkError(err error) {
+	if err == nil {
+		return
+	}
+
+	if *jsonErrors {
+		writeJSONError(os.Stderr, errorCode(err), err.Error())
+		os.Exit(exitError)
+	}
+
+	logf(levelError, "%v", err)
+	os.Exit(exitError)
+}
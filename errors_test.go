@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	_, err := os.ReadFile(path.Join(t.TempDir(), "missing"))
+
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{err, errCodeIO},
+		{fmt.Errorf("keyfile: %w", err), errCodeIO},
+		{errors.New("keyfile is corrupt"), errCodeParse},
+		{withCode(errCodeSign, errors.New("signing failed")), errCodeSign},
+		{withCode(errCodeArgs, err), errCodeArgs},
+		{withCode(errCodeSign, fmt.Errorf("line 1: %w", withCode(errCodeArgs, err))), errCodeArgs},
+	}
+
+	for _, c := range cases {
+		if code := errorCode(c.err); code != c.code {
+			t.Errorf("%v has code %q, expected %q.", c.err, code, c.code)
+		}
+	}
+
+	if withCode(errCodeIO, nil) != nil {
+		t.Error("A nil error with a code is not nil.")
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	var buf bytes.Buffer
+	writeJSONError(&buf, errCodeParse, `keyfile "x" is corrupt`)
+
+	var out jsonError
+
+	err := json.Unmarshal(buf.Bytes(), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if out.Error != `keyfile "x" is corrupt` || out.Code != errCodeParse {
+		t.Errorf("Wrote %+v, expected the message with code %q.", out, errCodeParse)
+	}
+}
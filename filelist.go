@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The messageFileList flag signs every file named in a list, loading the key
+// pair only once, and prints a detached signature record for each as a JSON
+// array.
+var messageFileList = flag.String("message-file-list", "", `sign every file named, one per line, in this file ("-" means standard in) and print a JSON array of detached signatures`)
+
+// The fileSignature struct is the record --message-file-list prints for each
+// file: its path as listed, the hex digest of its contents and its detached
+// signature, as --detached writes it.
+type fileSignature struct {
+	Path      string `json:"path"`
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+// The openFileList function takes in the path given to --message-file-list and
+// returns the list to read the paths from, standard in for "-", or an error if
+// the file can not be opened.
+func openFileList(listPath string) (io.ReadCloser, error) {
+	if listPath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(listPath)
+}
+
+// The signFileList function takes in a reader holding one path per line, the
+// private key, the signer.Options, whether to stop at the first bad file, and a
+// writer for reporting bad files.  It signs the contents of each file, as
+// --file --detached does, and returns a JSON array of the fileSignature of
+// every file that was signed, in order, and the number of files that were not.
+// Blank lines are skipped.  A file that can not be read or signed is reported
+// to the writer by its path.  It returns an error if the reader fails, or for
+// the first bad file if failFast is true.
+func signFileList(r io.Reader, privKey crypto.Signer, opts signer.Options, failFast bool, report io.Writer) (string, int, error) {
+	records := []fileSignature{}
+	failed := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines may end in "\r\n" as well as "\n".
+		filePath := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(filePath) == "" {
+			continue
+		}
+
+		record, err := signListedFile(filePath, privKey, opts)
+		if err != nil {
+			if failFast {
+				return "", failed + 1, fmt.Errorf("%s: %w", filePath, err)
+			}
+			fmt.Fprintf(report, "%s: %v\n", filePath, err)
+			failed++
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", failed, err
+	}
+
+	outJSON, err := marshalJSON(records)
+	if err != nil {
+		return "", failed, err
+	}
+
+	return string(outJSON), failed, nil
+}
+
+// The signListedFile function takes in the path of a file, the private key and
+// the signer.Options, and returns the fileSignature of the file, or an error if
+// it can not be read, is empty without --allow-empty, or can not be signed.
+func signListedFile(filePath string, privKey crypto.Signer, opts signer.Options) (fileSignature, error) {
+	contents, err := readMessageFile(filePath)
+	if err != nil {
+		return fileSignature{}, withCode(errCodeIO, err)
+	}
+	if err := checkEmpty(contents); err != nil {
+		return fileSignature{}, withCode(errCodeArgs, err)
+	}
+
+	digest, err := signer.HashSum(opts.Hash, contents)
+	if err != nil {
+		return fileSignature{}, err
+	}
+
+	sig, err := signatureOnly(contents, privKey, opts)
+	if err != nil {
+		return fileSignature{}, withCode(errCodeSign, err)
+	}
+
+	return fileSignature{Path: filePath, Digest: hex.EncodeToString(digest), Signature: sig}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestSignFileList(t *testing.T) {
+	privKey, pubKey := keyContents()
+	dir := t.TempDir()
+
+	first := path.Join(dir, "first")
+	second := path.Join(dir, "second")
+	if err := os.WriteFile(first, []byte("Hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte{0x00, 0xff}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := path.Join(dir, "missing")
+	list := first + "\r\n" + missing + "\n\n" + second + "\n"
+
+	var report bytes.Buffer
+	signed, failed, err := signFileList(strings.NewReader(list), privKey, signer.Options{}, false, &report)
+	if err != nil {
+		t.Fatalf("Error signing file list: %v", err)
+	}
+
+	if failed != 1 || !strings.HasPrefix(report.String(), missing+": ") {
+		t.Errorf("%d files failed with report %q, expected %s only.", failed, report.String(), missing)
+	}
+
+	var records []fileSignature
+	if err := json.Unmarshal([]byte(signed), &records); err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+	if len(records) != 2 || records[0].Path != first || records[1].Path != second {
+		t.Fatalf("Signed %+v, expected %s and %s.", records, first, second)
+	}
+
+	// The SHA256 digest of "Hello".
+	if records[0].Digest != "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969" {
+		t.Errorf("The digest of %s is %s.", first, records[0].Digest)
+	}
+
+	pub, err := signer.ParsePublicKey([]byte(pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		valid, err := verifyDetached(record.Path, writeTempFile(t, dir, record.Signature), pub, signer.Options{})
+		if err != nil || !valid {
+			t.Errorf("The signature of %s does not verify: %v", record.Path, err)
+		}
+	}
+
+	_, _, err = signFileList(strings.NewReader(list), privKey, signer.Options{}, true, &report)
+	if err == nil || !strings.HasPrefix(err.Error(), missing+": ") {
+		t.Errorf("Fail fast gave %v, expected an error for %s.", err, missing)
+	}
+}
+
+func writeTempFile(t *testing.T, dir, contents string) string {
+	f, err := os.CreateTemp(dir, "sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
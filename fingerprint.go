@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The fingerprintCommand function runs the "fingerprint" subcommand with the
+// arguments that follow it on the command line.  With --stdin it prints the
+// fingerprint of every PEM public key read from standard in.
+func fingerprintCommand(args []string) {
+	flags := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	stdin := flags.Bool("stdin", false, "read concatenated PEM public keys from standard in")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if !*stdin || flags.NArg() != 0 {
+		usageError("Please provide --stdin and pipe the PEM public keys in.")
+	}
+
+	contents, err := io.ReadAll(os.Stdin)
+	checkError(err)
+
+	if fingerprintAll(os.Stdout, contents) != 0 {
+		os.Exit(exitError)
+	}
+}
+
+// The fingerprintAll function takes in a writer and a slice of bytes holding
+// concatenated PEM blocks.  It writes the fingerprint of each public key, one
+// per line, and a note in place of any block that is not an ECDSA public key.
+// It returns the number of blocks that were skipped.
+func fingerprintAll(w io.Writer, contents []byte) int {
+	skipped := 0
+
+	for n := 1; ; n++ {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+
+		fp, err := blockFingerprint(block)
+		if err != nil {
+			fmt.Fprintf(w, "skipped block %d: %v\n", n, err)
+			skipped++
+			continue
+		}
+
+		fmt.Fprintln(w, fp)
+	}
+
+	return skipped
+}
+
+// The blockFingerprint function takes in a PEM block and returns the
+// fingerprint of the ECDSA public key it holds, or an error if it does not
+// hold one.
+func blockFingerprint(block *pem.Block) (string, error) {
+	if block.Type != "PUBLIC KEY" {
+		return "", fmt.Errorf("%q is not a public key", block.Type)
+	}
+
+	pubKey, err := signer.PublicKeyFromBlock(block)
+	if err != nil {
+		return "", err
+	}
+
+	return signer.Fingerprint(pubKey)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+const malformedPubKey = `-----BEGIN PUBLIC KEY-----
+bm90IGEgcHVibGljIGtleQ==
+-----END PUBLIC KEY-----
+`
+
+func TestFingerprintAll(t *testing.T) {
+	privKey, pubKey := keyContents()
+
+	fp, err := signer.Fingerprint(&privKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Error fingerprinting key: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	skipped := fingerprintAll(&buf, []byte(pubKey+malformedPubKey+pubKey))
+	if skipped != 1 {
+		t.Errorf("Skipped %d blocks, expected 1.", skipped)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Printed %d lines, expected 3: %q", len(lines), buf.String())
+	}
+
+	if lines[0] != fp || lines[2] != fp {
+		t.Errorf("Fingerprints %q and %q do not match %q.", lines[0], lines[2], fp)
+	}
+
+	if !strings.HasPrefix(lines[1], "skipped block 2") {
+		t.Errorf("The malformed block was not noted: %q", lines[1])
+	}
+}
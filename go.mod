@@ -0,0 +1,3 @@
+module github.com/KiraFox/crypto-sign-challenge
+
+go 1.24
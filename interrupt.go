@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The catchInterrupt function installs a handler for Ctrl-C, for the time a
+// passphrase is being asked for while a key pair is created or decrypted.  On
+// SIGINT it removes the lock and temporary files the signer package holds,
+// so the key pair file is left as it was, calls restore to put the terminal
+// back as it was, and exits with the exitInterrupted code.  It returns a
+// function that removes the handler again.
+func catchInterrupt(restore func()) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+			signer.RemovePending()
+			restore()
+			// The prompt is still waiting for the rest of its line.
+			fmt.Fprintln(os.Stderr)
+			logf(levelError, "Interrupted, the key pair file was left as it was.")
+			os.Exit(exitInterrupted)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
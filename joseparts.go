@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"flag"
+	"fmt"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The joseParts flag prints r and s of an ECDSA signature as separate JOSE
+// fields instead of the JSON, for JWT libraries that take them one at a time.
+var joseParts = flag.Bool("jose-parts", false, `print only r and s of the ECDSA signature, each Base64url encoded, as {"r":"...","s":"..."}`)
+
+// The joseSignature struct holds r and s of an ECDSA signature, each left
+// padded to the byte length of the curve and Base64url encoded without
+// padding, as JOSE writes them.
+type joseSignature struct {
+	R string `json:"r"`
+	S string `json:"s"`
+}
+
+// The splitSignature function takes in an ASN.1 DER ECDSA signature and the
+// public key it verifies under, and returns its r and s as a joseSignature, or
+// an error if the key is not an ECDSA key or the signature is malformed.
+func splitSignature(sign []byte, pubKey crypto.PublicKey) (joseSignature, error) {
+	if _, ok := pubKey.(*ecdsa.PublicKey); !ok {
+		return joseSignature{}, fmt.Errorf("a %s signature has no r and s, only ECDSA signatures do", signer.KeyDescription(pubKey))
+	}
+
+	// The raw signature is r and s, each already left padded to the byte
+	// length of the curve.
+	raw, err := signer.RawSignature(sign, pubKey)
+	if err != nil {
+		return joseSignature{}, err
+	}
+
+	size := len(raw) / 2
+	return joseSignature{
+		R: base64.RawURLEncoding.EncodeToString(raw[:size]),
+		S: base64.RawURLEncoding.EncodeToString(raw[size:]),
+	}, nil
+}
+
+// The josePartsSign function takes in the input as a string, the private key
+// and the signer.Options, and returns the JSON of the r and s of its signature,
+// or an error if there is one.  As for a JWS the hash is the one JOSE pairs
+// with the curve, SHA512 for ES512, whatever the signer.Options say.
+func josePartsSign(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	_, hash, err := jwsAlgorithm(privKey.Public())
+	if err != nil {
+		return "", err
+	}
+	opts.Hash = hash
+
+	preimage, err := signer.SignedBytes(input, opts)
+	if err != nil {
+		return "", err
+	}
+
+	sign, err := signer.SignMessage(privKey, string(preimage), opts)
+	if err != nil {
+		return "", err
+	}
+
+	parts, err := splitSignature(sign, privKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	outJSON, err := marshalJSON(parts)
+	if err != nil {
+		return "", err
+	}
+	return string(outJSON), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestSplitSignaturePadding(t *testing.T) {
+	privKey, _ := keyContents()
+
+	// r and s far shorter than the 66 bytes of P-521 are left padded to it.
+	sign, err := asn1.Marshal(struct{ R, S *big.Int }{big.NewInt(1), big.NewInt(0x0102)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := splitSignature(sign, privKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := base64.RawURLEncoding.DecodeString(parts.R)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := base64.RawURLEncoding.DecodeString(parts.S)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantR, wantS := make([]byte, 66), make([]byte, 66)
+	wantR[65] = 0x01
+	wantS[64], wantS[65] = 0x01, 0x02
+	if string(r) != string(wantR) || string(s) != string(wantS) {
+		t.Errorf("r is %x and s is %x, expected %x and %x.", r, s, wantR, wantS)
+	}
+}
+
+func TestJosePartsSign(t *testing.T) {
+	privKey, _ := keyContents()
+
+	output, err := josePartsSign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parts joseSignature
+	if err := json.Unmarshal([]byte(output), &parts); err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	r, err := base64.RawURLEncoding.DecodeString(parts.R)
+	if err != nil || len(r) != 66 {
+		t.Fatalf("r is %d bytes (%v), expected 66.", len(r), err)
+	}
+	s, err := base64.RawURLEncoding.DecodeString(parts.S)
+	if err != nil || len(s) != 66 {
+		t.Fatalf("s is %d bytes (%v), expected 66.", len(s), err)
+	}
+
+	// ES512 signs the SHA512 digest of the preimage.
+	digest := sha512.Sum512([]byte(signer.Preimage("Hello", signer.Options{})))
+	if !ecdsa.Verify(&privKey.PublicKey, digest[:], new(big.Int).SetBytes(r), new(big.Int).SetBytes(s)) {
+		t.Error("r and s do not verify as an ES512 signature.")
+	}
+}
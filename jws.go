@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The jws flag makes the tool print a JWS compact serialization instead of the
+// JSON, so the output can be checked with standard JWT libraries.
+var jws = flag.Bool("jws", false, "print a JWS compact serialization (header.payload.signature) instead of JSON")
+
+// The jwsHeader struct holds the protected header of a JWS.
+type jwsHeader struct {
+	Alg string `json:"alg"`
+}
+
+// The jwsAlgorithm function takes in a public key and returns the JWS "alg" for
+// it and the name of the hash the algorithm signs the digest of, or an error if
+// JWS has no algorithm for the key.  ECDSA keys are ES256, ES384 or ES512 by
+// their curve, as in RFC 7518, and Ed25519 keys are EdDSA, as in RFC 8037.
+func jwsAlgorithm(pubKey crypto.PublicKey) (string, string, error) {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return "ES256", "sha256", nil
+		case 384:
+			return "ES384", "sha384", nil
+		case 521:
+			return "ES512", "sha512", nil
+		}
+		return "", "", fmt.Errorf("JWS has no algorithm for the %s curve", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "EdDSA", "", nil
+	default:
+		return "", "", fmt.Errorf("JWS has no algorithm for a %T", pubKey)
+	}
+}
+
+// The jwsSign function takes in the input as a string, the private key and the
+// signer.Options, and returns the JWS compact serialization of the input: the
+// Base64url encoded header, payload and signature joined by dots, or an error
+// if there is one.  The hash is the one the JWS algorithm requires, whatever
+// the signer.Options say, and the ECDSA signature is raw r||s as JWS requires.
+func jwsSign(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	alg, hash, err := jwsAlgorithm(privKey.Public())
+	if err != nil {
+		return "", err
+	}
+	opts.Hash = hash
+
+	header, err := json.Marshal(jwsHeader{Alg: alg})
+	if err != nil {
+		return "", err
+	}
+
+	// A hex or Base64 input is carried as the bytes it encodes, the payload
+	// has no room to say how it was given.
+	payload, err := signer.DecodeMessage(input, opts.InputEncoding)
+	if err != nil {
+		return "", err
+	}
+
+	// The signing input is the encoded header and payload, as they appear in
+	// the output.
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	sign, err := signer.SignMessage(privKey, signingInput, opts)
+	if err != nil {
+		return "", err
+	}
+
+	encSign, err := signer.EncodeSignature(sign, privKey.Public(), signer.SigFormatRawBase64URL, "")
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encSign, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestJWS(t *testing.T) {
+	privKey, _ := keyContents()
+
+	token, err := jwsSign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing JWS: %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("The JWS has %d parts, expected 3.", len(parts))
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || string(header) != `{"alg":"ES512"}` {
+		t.Errorf("The JWS header is %q, expected {\"alg\":\"ES512\"}: %v", header, err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || string(payload) != "Hello" {
+		t.Errorf("The JWS payload is %q, expected \"Hello\": %v", payload, err)
+	}
+
+	sign, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sign) != 132 {
+		t.Errorf("The JWS signature is %d bytes, expected 132 raw bytes: %v", len(sign), err)
+	}
+
+	der, err := signer.DecodeSignature(parts[2], &privKey.PublicKey, signer.SigFormatRawBase64URL, "")
+	if err != nil {
+		t.Fatalf("Error decoding JWS signature: %v", err)
+	}
+
+	// The signing input is signed as it is, not framed as a preimage.
+	digest := sha512.Sum512([]byte(parts[0] + "." + parts[1]))
+	if !signer.VerifyHashed(&privKey.PublicKey, digest[:], der) {
+		t.Error("The JWS signature does not verify as ES512.")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// How many keys the --vanity search tries between progress reports.
+const vanityProgressInterval = 1000
+
+// Prefixes longer than this get a warning, every extra hex character makes the
+// search 16 times longer.
+const vanityWarnLength = 4
+
+// The keygenCommand function runs the "keygen" subcommand with the arguments
+// that follow it on the command line.  It creates the key pair file, refusing
+// to replace one that already exists unless --force is given, and prints the
+// public key.
+func keygenCommand(args []string) {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	flags.StringVar(keyfileFlag, "keyfile", "", "path of the key pair file")
+	flags.StringVar(identity, "identity", "", "name of the key pair to create, kept alongside any others in the file")
+	flags.StringVar(algo, "algo", "", `key algorithm: "ecdsa" (the default) or "ed25519"`)
+	flags.StringVar(curve, "curve", "", `curve for an ECDSA key: "p256", "p384" or "p521" (the default)`)
+	flags.BoolVar(pkcs8, "pkcs8", *pkcs8, "save an ECDSA private key in PKCS#8 form instead of SEC1")
+	flags.Var(&keyfileMode, "keyfile-mode", keyfileModeUsage)
+	flags.BoolVar(allowInsecurePerms, "allow-insecure-perms", *allowInsecurePerms, "allow a --keyfile-mode that lets every user read or write the key pair file")
+	flags.BoolVar(strictPerms, "strict-perms", *strictPerms, "refuse a key pair file with looser permissions than --keyfile-mode instead of warning")
+	flags.BoolVar(encryptKey, "encrypt", *encryptKey, "encrypt the private key with a passphrase")
+	force := flags.Bool("force", false, "replace an existing key pair, rotating the identity")
+	vanity := flags.String("vanity", "", "keep generating keys until the fingerprint starts with this hex prefix")
+	maxAttempts := flags.Int("max-attempts", 1000000, "give up the --vanity search after this many keys, 0 means no limit")
+	timeout := flags.Duration("timeout", 0, "give up the --vanity search after this long, 0 means no limit")
+	flags.BoolVar(verbose, "verbose", *verbose, "log the key pair file and key used to standard error")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		usageError("The keygen command does not take any arguments.")
+	}
+
+	prefix := strings.ToLower(*vanity)
+	if strings.Trim(prefix, "0123456789abcdef") != "" {
+		usageError("The vanity prefix %q is not hexadecimal.", *vanity)
+	}
+
+	filePath, err := keyfilePath()
+	checkError(err)
+
+	exists, err := keyOptions(*algo).HasKeyPair(filePath)
+	checkError(err)
+	if exists && !*force {
+		if *identity != "" {
+			usageError("A key pair named %q already exists in %s, use --force to replace it.", *identity, filePath)
+		}
+		usageError("A key pair already exists at %s, use --force to replace it.", filePath)
+	}
+
+	var (
+		privKey crypto.Signer
+		pubKey  string
+		fp      string
+	)
+
+	if prefix == "" {
+		_, pubKey, fp, err = createSaveKey(filePath, *algo, rand.Reader)
+		checkError(withCode(errCodeSign, err))
+	} else {
+		if len(prefix) > vanityWarnLength {
+			fmt.Fprintf(os.Stderr, "Warning: a %d character prefix takes about %.0f keys to find.\n",
+				len(prefix), vanityExpectedAttempts(prefix))
+		}
+
+		// Stop searching on Ctrl-C or when the timeout runs out.
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+		if *timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		privKey, err = vanityKey(ctx, *algo, prefix, *maxAttempts, func(attempts int) {
+			fmt.Fprintf(os.Stderr, "Tried %d keys...\n", attempts)
+		})
+		checkError(withCode(errCodeSign, err))
+
+		pubKey, err = saveKey(filePath, privKey)
+		checkError(err)
+
+		fp, err = signer.Fingerprint(privKey.Public())
+		checkError(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Fingerprint: %s\n", fp)
+	fmt.Print(pubKey)
+}
+
+// The vanityKey function takes in a context, the key algorithm, a lowercase hex
+// prefix, the most keys to try (0 for no limit) and a function called with the
+// number of keys tried so far every vanityProgressInterval keys.  It returns
+// the first private key whose public key fingerprint starts with the prefix, or
+// an error if the context is done or the attempts run out first.
+func vanityKey(ctx context.Context, algo, prefix string, maxAttempts int, progress func(int)) (crypto.Signer, error) {
+	for attempt := 1; maxAttempts <= 0 || attempt <= maxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("vanity search stopped after %d keys: %v", attempt-1, ctx.Err())
+		default:
+		}
+
+		privateKey, err := signer.GenerateKey(algo, *curve)
+		if err != nil {
+			return nil, err
+		}
+
+		fp, err := signer.Fingerprint(privateKey.Public())
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(fp, prefix) {
+			return privateKey, nil
+		}
+
+		if progress != nil && attempt%vanityProgressInterval == 0 {
+			progress(attempt)
+		}
+	}
+
+	return nil, fmt.Errorf("no fingerprint starting with %q found in %d keys", prefix, maxAttempts)
+}
+
+// The vanityExpectedAttempts function takes in a hex prefix and returns the
+// average number of keys needed to find a fingerprint starting with it.
+func vanityExpectedAttempts(prefix string) float64 {
+	attempts := 1.0
+	for range prefix {
+		attempts *= 16
+	}
+	return attempts
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestVanityKey(t *testing.T) {
+	privKey, err := vanityKey(context.Background(), signer.AlgoECDSA, "a", 10000, nil)
+	if err != nil {
+		t.Fatalf("Error finding vanity key: %v", err)
+	}
+
+	fp, err := signer.Fingerprint(privKey.Public())
+	if err != nil {
+		t.Fatalf("Error fingerprinting key: %v", err)
+	}
+
+	if !strings.HasPrefix(fp, "a") {
+		t.Errorf("Fingerprint %s does not start with the prefix.", fp)
+	}
+}
+
+func TestVanityKeyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := vanityKey(ctx, signer.AlgoECDSA, "ffffffff", 0, nil)
+	if err == nil {
+		t.Error("A cancelled vanity search did not return an error.")
+	}
+}
+
+func TestVanityKeyAttempts(t *testing.T) {
+	_, err := vanityKey(context.Background(), signer.AlgoECDSA, "ffffffff", 3, nil)
+	if err == nil {
+		t.Error("The vanity search did not stop after the attempt cap.")
+	}
+}
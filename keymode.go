@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The fileModeValue type is the value of --keyfile-mode, octal permissions
+// such as 0600, and is a flag.Value.
+type fileModeValue os.FileMode
+
+func (m *fileModeValue) String() string {
+	if m == nil || *m == 0 {
+		return fmt.Sprintf("%04o", uint32(signer.DefaultKeyfileMode))
+	}
+	return fmt.Sprintf("%04o", uint32(*m))
+}
+
+func (m *fileModeValue) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return fmt.Errorf("%q is not an octal file mode such as 0600", value)
+	}
+	if mode&0600 != 0600 {
+		return fmt.Errorf("%04o does not let the owner read and write the key pair file", mode)
+	}
+	*m = fileModeValue(mode)
+	return nil
+}
+
+// The keyfileMode flag is the permissions a key pair file is created with,
+// Owner read/write only unless an environment mandates, for example, group
+// read access.  Subcommands that create key pairs register the same flag on
+// their own flag sets.
+var keyfileMode fileModeValue
+
+// The allowInsecurePerms flag allows a --keyfile-mode that lets every user
+// read or write the key pair file.
+var allowInsecurePerms = flag.Bool("allow-insecure-perms", false, "allow a --keyfile-mode that lets every user read or write the key pair file")
+
+// The strictPerms flag makes a key pair file with looser permissions than
+// expected an error rather than a warning, the way SSH refuses a private key
+// other users can read.
+var strictPerms = flag.Bool("strict-perms", false, "refuse a key pair file with looser permissions than --keyfile-mode instead of warning")
+
+// The keyfileModeUsage string is the help of the --keyfile-mode flag.
+const keyfileModeUsage = "permissions a new key pair file is saved with, an octal `mode` such as 0640, 0600 unless given"
+
+func init() {
+	flag.Var(&keyfileMode, "keyfile-mode", keyfileModeUsage)
+}
+
+// The expectedKeyfileMode function returns the permissions a key pair file is
+// expected to have: the --keyfile-mode, or signer.DefaultKeyfileMode.
+func expectedKeyfileMode() os.FileMode {
+	if keyfileMode == 0 {
+		return signer.DefaultKeyfileMode
+	}
+	return os.FileMode(keyfileMode)
+}
+
+// The checkKeyfilePerms function takes in the path of a key pair file and
+// prints a warning on standard error if other users have permissions on it
+// that the expected mode does not give them, since they may be able to read
+// the private key.  With --strict-perms it returns the problem as an error
+// instead.
+func checkKeyfilePerms(filePath string) error {
+	err := keyfilePermsError(filePath, expectedKeyfileMode())
+	if err == nil {
+		return nil
+	}
+	if *strictPerms {
+		return withCode(errCodeIO, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: %v.\n", err)
+	return nil
+}
+
+// The keyfilePermsError function takes in the path of a key pair file and the
+// permissions it is expected to have, and returns an error saying how to fix
+// them if the file gives other users permissions the expected ones do not, or
+// nil if it does not.  Nothing is checked if the file can not be found, or on
+// Windows, whose files have no such permission bits.
+func keyfilePermsError(filePath string, expected os.FileMode) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+
+	if perm := info.Mode().Perm(); perm&^expected != 0 {
+		return fmt.Errorf("%s has permissions %04o, looser than %04o, so other users may be able to read the private key; fix it with \"chmod %o %s\"",
+			filePath, uint32(perm), uint32(expected), uint32(expected), filePath)
+	}
+	return nil
+}
+
+// The insecureModeHint function takes in an error from saving a key pair file
+// and returns it with a hint to use --allow-insecure-perms if the error is
+// signer.ErrInsecureMode, or else returns it as it is.
+func insecureModeHint(err error) error {
+	if !errors.Is(err, signer.ErrInsecureMode) {
+		return err
+	}
+	return withCode(errCodeArgs, fmt.Errorf("%w, use --allow-insecure-perms to allow it", err))
+}
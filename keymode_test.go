@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestFileModeValue(t *testing.T) {
+	for value, want := range map[string]fileModeValue{
+		"0600": 0600,
+		"640":  0640,
+		"0644": 0644,
+	} {
+		var m fileModeValue
+		if err := m.Set(value); err != nil || m != want {
+			t.Errorf("Setting %q gave %04o, %v.", value, uint32(m), err)
+		}
+	}
+
+	for _, value := range []string{"", "0800", "rw-------", "01600", "0400", "0060"} {
+		var m fileModeValue
+		if err := m.Set(value); err == nil {
+			t.Errorf("Setting %q gave %04o and no error.", value, uint32(m))
+		}
+	}
+
+	var m fileModeValue
+	if m.String() != "0600" {
+		t.Errorf("The default mode is shown as %s.", m.String())
+	}
+}
+
+func TestKeyfilePerms(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows files have no permission bits.")
+	}
+
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+	if _, _, _, err := createSaveKey(filePath, "", rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is created Owner read/write only, which is what is expected.
+	if err := keyfilePermsError(filePath, signer.DefaultKeyfileMode); err != nil {
+		t.Errorf("A new key pair file has loose permissions: %v", err)
+	}
+
+	if err := os.Chmod(filePath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyfilePermsError(filePath, signer.DefaultKeyfileMode); err == nil || !strings.Contains(err.Error(), "0644") {
+		t.Errorf("A world readable key pair file returned %v.", err)
+	}
+	if err := keyfilePermsError(filePath, 0644); err != nil {
+		t.Errorf("A key pair file with the expected permissions returned %v.", err)
+	}
+
+	// The file is only warned about, unless --strict-perms is given.
+	if _, _, err := useKey(filePath); err != nil {
+		t.Errorf("A world readable key pair file was refused without --strict-perms: %v", err)
+	}
+
+	*strictPerms = true
+	defer func() { *strictPerms = false }()
+
+	if _, _, err := useKey(filePath); err == nil {
+		t.Error("A world readable key pair file was loaded with --strict-perms.")
+	}
+
+	if err := os.Chmod(filePath, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := useKey(filePath); err != nil {
+		t.Errorf("An Owner only key pair file was refused with --strict-perms: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The name list prints for the key pair saved without a name.
+const defaultIdentityName = "(default)"
+
+// The listCommand function runs the "list" subcommand with the arguments that
+// follow it on the command line.  It prints the name and fingerprint of every
+// key pair in the key pair file.
+func listCommand(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.StringVar(keyfileFlag, "keyfile", "", "path of the key pair file")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		usageError("The list command does not take any arguments.")
+	}
+
+	filePath, err := keyfilePath()
+	checkError(err)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		usageError("There is no key pair file at %s, use keygen to create one.", filePath)
+	}
+
+	checkError(listIdentities(os.Stdout, filePath))
+}
+
+// The listIdentities function takes in a writer and the file path of the key
+// pair file, and writes one line for each key pair in it: its name, or
+// defaultIdentityName for the default key pair, and the fingerprint of its
+// public key.  It returns an error if the file can not be read.
+func listIdentities(w io.Writer, filePath string) error {
+	identities, err := keyOptions("").ListIdentities(filePath)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range identities {
+		fp, err := signer.Fingerprint(id.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		name := id.Name
+		if name == "" {
+			name = defaultIdentityName
+		}
+		fmt.Fprintf(w, "%s  %s\n", name, fp)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestListIdentities(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+
+	var expected string
+	for _, name := range []string{"", "work", "ci"} {
+		privKey, _, err := signer.KeyOptions{Curve: "p256", Identity: name}.Create(filePath)
+		if err != nil {
+			t.Fatalf("Error creating key pair %q: %v", name, err)
+		}
+
+		fp, err := signer.Fingerprint(privKey.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "" {
+			name = defaultIdentityName
+		}
+		expected += fmt.Sprintf("%s  %s\n", name, fp)
+	}
+
+	var out bytes.Buffer
+	if err := listIdentities(&out, filePath); err != nil {
+		t.Fatalf("Error listing key pairs: %v", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("Listed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// The log levels of --log-level, from the fewest messages to the most.  Errors
+// are always logged.
+const (
+	levelError = iota
+	levelInfo
+	levelDebug
+)
+
+// The levelNames hold the name of each log level, as given to --log-level and
+// written before each message.
+var levelNames = []string{"error", "info", "debug"}
+
+// The logLevelValue type is the value of the --log-level flag.  It refuses a
+// level it does not know when the command line is parsed.
+type logLevelValue int
+
+func (l *logLevelValue) String() string {
+	if l == nil || int(*l) >= len(levelNames) {
+		return levelNames[levelError]
+	}
+	return levelNames[*l]
+}
+
+func (l *logLevelValue) Set(name string) error {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			*l = logLevelValue(level)
+			return nil
+		}
+	}
+	return fmt.Errorf(`unknown log level %q, please use "error", "info" or "debug"`, name)
+}
+
+// The logLevel flag chooses which messages are logged to standard error.
+// Standard out is the same whatever the level.  Subcommands register the same
+// flag on their own flag sets.
+var logLevel = logLevelValue(levelError)
+
+// The logLevelUsage is the usage of the --log-level flag, the same for the
+// signer and each subcommand.
+const logLevelUsage = "`level` of the messages logged to standard error: \"error\" (the default), \"info\" or \"debug\""
+
+func init() {
+	flag.Var(&logLevel, "log-level", logLevelUsage)
+}
+
+// The verbose flag logs where the key pair came from and how the message is
+// signed to standard error, the same as --log-level info.
+var verbose = flag.Bool("verbose", false, "log the key pair file, key and hash used to standard error, the same as --log-level info")
+
+// The logger writes the log messages.  It writes to standard error so they
+// never mix with the output on standard out.
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// The logEnabled function takes in a log level and returns whether messages of
+// that level are logged, with the level chosen by --log-level or --verbose.
+func logEnabled(level int) bool {
+	current := int(logLevel)
+	if *verbose && current < levelInfo {
+		current = levelInfo
+	}
+	return level <= current
+}
+
+// The logf function takes in a log level, and a format and arguments as
+// log.Printf does, and logs the message with its level to standard error if
+// that level is enabled.
+func logf(level int, format string, a ...interface{}) {
+	if !logEnabled(level) {
+		return
+	}
+	logger.Printf("%s: %s", strings.ToUpper(levelNames[level]), fmt.Sprintf(format, a...))
+}
+
+// The verbosef function takes in a format and arguments as log.Printf does and
+// logs the message at the info level.
+func verbosef(format string, a ...interface{}) {
+	logf(levelInfo, format, a...)
+}
+
+// The debugf function takes in a format and arguments as log.Printf does and
+// logs the message at the debug level.
+func debugf(format string, a ...interface{}) {
+	logf(levelDebug, format, a...)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger = log.New(&buf, "", 0)
+	defer func() {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+		logLevel = levelError
+		*verbose = false
+	}()
+
+	if err := logLevel.Set("trace"); err == nil {
+		t.Error("An unknown log level was accepted.")
+	}
+
+	logf(levelError, "failed %d", 1)
+	verbosef("info")
+	debugf("debug")
+	if buf.String() != "ERROR: failed 1\n" {
+		t.Errorf("Logged %q at the error level, expected only the error.", buf.String())
+	}
+
+	buf.Reset()
+	*verbose = true
+	verbosef("info")
+	debugf("debug")
+	if buf.String() != "INFO: info\n" {
+		t.Errorf("Logged %q with --verbose, expected only the info message.", buf.String())
+	}
+
+	buf.Reset()
+	*verbose = false
+	if err := logLevel.Set("DEBUG"); err != nil {
+		t.Fatalf("Error setting the log level: %v", err)
+	}
+	verbosef("info")
+	debugf("debug")
+	if !strings.Contains(buf.String(), "INFO: info\n") || !strings.Contains(buf.String(), "DEBUG: debug\n") {
+		t.Errorf("Logged %q at the debug level, expected both messages.", buf.String())
+	}
+}
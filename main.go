@@ -1,267 +1,1204 @@
 package main
 
 import (
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/asn1"
-	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"math/big"
+	"io"
 	"os"
-	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
 )
 
-// This is the path the file will be saved at so there is only one place
-// the file will be retrieved from and saved to, no matter what directory
-// you run the command in on the command line.
-var dir = fmt.Sprintf("%s/.local/share/signer", os.Getenv("HOME"))
+// This is the path, under the home directory, the file will be saved at so
+// there is only one place the file will be retrieved from and saved to, no
+// matter what directory you run the command in on the command line.
+var dir = filepath.Join(".local", "share", "signer")
 
 // The name of the file that will be created or contain the saved key pair.
 const keyfile = "keypair.txt"
 
+// The environment variable that can hold the path of the key pair file instead.
+const keyfileEnv = "SIGNER_KEYFILE"
+
+// The identity flag chooses one of several key pairs kept in the key pair file
+// by name.  Empty means the default key pair.
+var identity = flag.String("identity", "", "name of the key pair to use when the key pair file holds several")
+
+// The keyfileFlag flag is the path of the key pair file.  It takes precedence
+// over the keyfileEnv environment variable, that over the config file, and all
+// of them over the default.
+var keyfileFlag = flag.String("keyfile", "", "path of the key pair file (default $"+keyfileEnv+", the config file or ~/.local/share/signer/"+keyfile+")")
+
+// The keyPath flag signs with a private key kept in a PEM file the tool does
+// not manage, instead of the key pair file.  The file is only ever read.
+var keyPath = flag.String("key", "", "sign with the private key in this PEM file instead of the key pair file")
+
+// The pkcs8 flag saves a newly created ECDSA private key in PKCS#8 form rather
+// than SEC1.  Existing keys load whichever form they are in.
+var pkcs8 = flag.Bool("pkcs8", false, "save a new ECDSA private key in PKCS#8 form instead of SEC1")
+
+// The format flag chooses how the signed message is written to standard out.
+// "json" is the schema from the code challenge prompt and "sigstore-ish" is the
+// bundle built in sigstore.go.  "pem-bundle" signs nothing and writes the PEM
+// bundle built in pembundle.go instead.
+var format = flag.String("format", "json", `output format: "json", "sigstore-ish", or "pem-bundle" to export the public key for a verifier`)
+
+// The opensslHint flag prints, on standard error, the openssl command a
+// recipient can run to verify the signature.
+var opensslHint = flag.Bool("compat-openssl-verify-cmd", false, "print the openssl command that verifies the signature to standard error")
+
+// The aad and aadEnv flags give associated data to bind into the signature
+// without writing it to the output.  The value of aadEnv is the name of an
+// environment variable holding the data, so it stays out of the process list.
+var (
+	aad    = flag.String("aad", "", "associated data to bind into the signature without writing it out")
+	aadEnv = flag.String("aad-env", "", "name of an environment variable holding the associated data")
+)
+
+// The outputFile flag writes the signed message to a file instead of standard
+// out.  "-" means standard out.
+var outputFile = flag.String("output", "", `write the signed message to this file instead of standard out ("-" means standard out)`)
+
+// The onlySignature flag prints only the signature, in the format chosen with
+// --sig-format, instead of the whole JSON.
+var onlySignature = flag.Bool("stdout-only-signature", false, "print only the signature instead of the JSON")
+
+// The armor flag writes only the DER signature, in a PEM SIGNATURE block with
+// headers naming the curve and the hash, instead of the JSON.  The noArmor
+// flag asks for the signature inline in the JSON, which is the default.
+var (
+	armor   = flag.Bool("armor", false, "write only the signature, as a PEM SIGNATURE block, instead of the JSON")
+	noArmor = flag.Bool("no-armor", false, "write the signature inline in the JSON, the default")
+)
+
+// The compact flag writes the JSON on one line with no spaces.  The fields are
+// always in the same order, so compact output is canonical: the same inputs
+// give the same bytes, with --deterministic for ECDSA keys.
+var compact = flag.Bool("compact", false, "write the JSON on one line, in canonical form")
+
+// The pretty flag writes the JSON indented, one field to a line, which is the
+// default.  --pretty=false is the same as --compact.
+var pretty = flag.Bool("pretty", true, "write the JSON indented, --pretty=false is the same as --compact")
+
+// The indent flag is the number of spaces the pretty JSON is indented by.
+var indent = flag.Int("indent", 4, "number of spaces to indent the JSON by, from 0 to 8")
+
+// The noNewline flag leaves out the newline after the output, for output that
+// is hashed or joined to other output.
+var noNewline = flag.Bool("no-newline", false, "do not end the output with a newline")
+
+// The noPubKey flag leaves the public key out of the JSON, for verifiers that
+// already have it.  Such JSON is verified with verify --verify-against.
+var noPubKey = flag.Bool("no-pubkey", false, "leave the public key out of the JSON")
+
+// The noKeyInfo flag leaves the curve and key ID out of the JSON, for the
+// smallest output.
+var noKeyInfo = flag.Bool("no-key-info", false, "leave the curve and key ID out of the JSON")
+
+// The outDER flag writes the public key in the JSON as Base64 DER, without the
+// PEM armor, for binary protocols.  The pubkey subcommand has the same flag.
+var outDER = flag.Bool("out-der", false, "write the public key in the JSON as Base64 DER instead of PEM")
+
+// The checksum flag adds the SHA256 checksum of the other fields to the JSON,
+// so corruption in transport is caught before verifying.  It is an integrity
+// aid, not a security feature.
+var checksum = flag.Bool("checksum", false, "add a checksum of the other fields to the JSON to detect corruption (not a security feature)")
+
+// The inputEncoding flag signs the bytes a hex or Base64 message encodes rather
+// than its text.
+var inputEncoding = flag.String("input-encoding", signer.InputRaw, `encoding of the message: "raw", "hex" or "base64"`)
+
+// The prehashed flag signs a message that is already the hex digest of the
+// data, computed with --hash, as it is instead of hashing it again.
+var prehashed = flag.Bool("prehashed", false, "the message is the hex digest of the data, made with --hash, and is signed without hashing it")
+
+// The detached flag writes only the signature of --file, to the file name with
+// ".sig" added, as gpg and minisign do.
+var detached = flag.Bool("detached", false, "with --file, write only the signature to FILE.sig instead of printing the JSON")
+
+// The allowEmpty flag signs an empty message, which is refused otherwise.
+var allowEmpty = flag.Bool("allow-empty", false, "sign an empty message instead of refusing it")
+
+// The file flag signs the raw bytes of a file instead of a text message.  The
+// message is then written Base64 encoded so binary data survives the JSON.
+var file = flag.String("file", "", "sign the contents of this file instead of a message")
+
+// The messageEnv flag is the name of an environment variable holding the
+// message, so a secret challenge is not on the command line, where other users
+// can see it in the list of processes.
+var messageEnv = flag.String("message-env", "", "name of an environment variable holding the message, e.g. SIGNER_MESSAGE")
+
+// The claims flag signs a JSON object of claims, such as {"sub":"alice"}, in
+// place of a message, like a small JWT.  The claims are signed and written in
+// canonical form, so a verifier rebuilds the exact bytes that were signed.
+var claims = flag.String("claims", "", `JSON object of claims to sign in place of a message, e.g. {"sub":"alice"}`)
+
+// The maxLen flag is the longest message, in characters rather than bytes,
+// that can be signed.  0 means there is no limit.  Files have their own limit.
+var maxLen = flag.Int("max-len", 250, "longest message, in characters, that can be signed, 0 means no limit")
+
+// The truncate flag signs the first --max-len characters of a message that is
+// too long instead of refusing it.
+var truncate = flag.Bool("truncate", false, "sign the first --max-len characters of a longer message instead of refusing it")
+
+// The largest file, in bytes, that --file will sign.
+const maxFileSize = 64 << 20
+
+// The algo flag chooses the key algorithm, "ecdsa" or "ed25519", used when a
+// new key pair is created.  If the key pair already exists it must match.
+var algo = flag.String("algo", "", `key algorithm for a new key pair: "ecdsa" (the default) or "ed25519"`)
+
+// The curve flag chooses the elliptic curve of a new ECDSA key pair.  If the
+// key pair already exists it must match.
+var curve = flag.String("curve", "", `curve for a new ECDSA key pair: "p256", "p384" or "p521" (the default)`)
+
+// The hash flag chooses the hash whose digest of the message ECDSA keys sign.
+var hash = flag.String("hash", "sha256", `hash for ECDSA signatures: "sha256", "sha384" or "sha512"`)
+
+// The deterministic flag makes ECDSA signatures repeatable, see RFC 6979.
+var deterministic = flag.Bool("deterministic", false, "make ECDSA signatures the same every time for the same message and key (RFC 6979)")
+
+// The hmacKey flag keys the digest of ECDSA signatures with a secret shared
+// with the verifier, binding the signature to it.
+var hmacKey = flag.String("hmac-key", "", "hex secret to key the digest with, HMAC with --hash, instead of hashing the message plainly")
+
+// The lowS flag makes ECDSA signatures use the lower of the two values of s
+// that verify, so a signature can not be changed into another valid one.
+var lowS = flag.Bool("low-s", false, "make ECDSA signatures always have an s in the lower half of the curve order, so each has one form")
+
+// The nonce flag is a challenge, such as one sent by the verifier, to sign
+// along with the message so the signature can not be replayed for another.
+var nonce = flag.String("nonce", "", "challenge to sign along with the message and write to the output")
+
+// The domain flag names the application the signature is for, so a signature
+// made for one can not be replayed to another.
+var domain = flag.String("domain", "", "application the signature is for, signed first and written to the output")
+
+// The ttl flag gives the signature a lifetime.  The issued and expiry times are
+// signed along with the message, and verify rejects the signature once it has
+// expired.
+var ttl = flag.Duration("ttl", 0, "how long the signature is valid for, for example 10m, 0 means forever")
+
+// The sigFormat flag chooses how the signature is written, see
+// signer/sigformat.go.
+var sigFormat = flag.String("sig-format", signer.SigFormatDER, `signature format: "der-base64", "rawhex" or "rawbase64url" (r||s)`)
+
+// The sigEncoding flag chooses the text encoding of the signature bytes in
+// place of the one --sig-format names, so an ASN.1 signature can be written as
+// hex.
+var sigEncoding = flag.String("sig-encoding", "", `signature encoding: "hex", "base64" or "base64url", the default is the one of --sig-format`)
+
+// The strict flag makes a hash that JOSE does not pair with the curve of the
+// key an error rather than a warning.
+var strict = flag.Bool("strict", false, "refuse a hash that JOSE does not pair with the curve of the key")
+
+// The debugMode flag makes a crash print its stack trace.  Subcommands register
+// the same flag on their own flag sets.
+var debugMode = flag.Bool("debug", false, "print a stack trace if the program crashes")
+
+// The exit codes of the program, besides 0 for success.  A signature that does
+// not verify is told apart from an error, such as a bad command line or a file
+// that can not be read or parsed, and a crash is told apart from both.  Ctrl-C
+// at a passphrase prompt exits with 128 plus the number of SIGINT, as shells
+// report it.
+const (
+	exitInvalid     = 1
+	exitError       = 2
+	exitPanic       = 3
+	exitInterrupted = 130
+)
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Please provide one argument that is 250 characters or less.")
-		os.Exit(1)
+	if code := protect(os.Stderr, debugMode, run); code != 0 {
+		os.Exit(code)
 	}
+}
 
-	input := os.Args[1]
+// The protect function takes in a writer, a pointer to the debug flag and a
+// function to run.  If the function panics, it writes a short error message to
+// the writer, followed by the stack trace only if the debug flag is set, and
+// returns the exitPanic code.  Otherwise it returns 0.
+func protect(w io.Writer, debugMode *bool, fn func()) (code int) {
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(w, "Unexpected error, the input could not be processed: %v\n", p)
+			if *debugMode {
+				w.Write(debug.Stack())
+			} else {
+				fmt.Fprintln(w, "Run again with --debug for more details.")
+			}
+			code = exitPanic
+		}
+	}()
+
+	fn()
+	return 0
+}
 
-	if len(input) > 250 {
-		fmt.Println("Please provide one argument that is 250 characters or less.")
-		os.Exit(1)
+// The run function reads the command line, loads or creates the key pair, and
+// prints the signed message.
+func run() {
+	// Subcommands are chosen by the first argument, anything else is a message
+	// to sign.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			verifyCommand(os.Args[2:])
+			return
+		case "keygen":
+			keygenCommand(os.Args[2:])
+			return
+		case "pubkey":
+			pubkeyCommand(os.Args[2:])
+			return
+		case "fingerprint":
+			fingerprintCommand(os.Args[2:])
+			return
+		case "sign-merkle":
+			merkleCommand(os.Args[2:])
+			return
+		case "rotate":
+			rotateCommand(os.Args[2:])
+			return
+		case "list":
+			listCommand(os.Args[2:])
+			return
+		case "verify-raw":
+			verifyRawCommand(os.Args[2:])
+			return
+		}
 	}
 
-	var (
-		privKey *ecdsa.PrivateKey
-		pubKey  string
-	)
+	applyConfig(flag.CommandLine)
+	flag.Parse()
 
-	filePath := fullPath(dir, keyfile)
+	// The version is printed before anything else is looked at, so it works
+	// with no message and no key pair.
+	if *showVersion {
+		if flag.NArg() != 0 {
+			usageError("--version does not take a message.")
+		}
+		fmt.Print(versionInfo())
+		return
+	}
 
-	// Check the status of the file to see if there are errors with it.
-	_, err := os.Stat(filePath)
-	if err != nil {
-		// If the file does not exist, run the function createSaveKey.
-		if os.IsNotExist(err) {
-			privKey, pubKey, err = createSaveKey(filePath)
-			checkError(err)
-		} else { // If any other error is returned besides "IsNotExist".
+	// The self-test signs its own message with its own keys, so it never
+	// looks at the key pair file.
+	if *selfTest {
+		if flag.NArg() != 0 {
+			usageError("--self-test does not take a message.")
+		}
+		if !runSelfTest(os.Stdout) {
+			os.Exit(exitInvalid)
+		}
+		return
+	}
+
+	if *yes && !*newKey {
+		usageError("--yes can only be used with --new.")
+	}
+	if *newKey && *dryRun {
+		usageError("--dry-run writes nothing, it can not be combined with --new.")
+	}
+
+	// A dry run only reports on the key pair, so the message, if any, is not
+	// read and nothing is written.
+	if *dryRun {
+		var (
+			plan string
+			err  error
+		)
+		if *keyPath != "" {
+			plan, err = dryRunKey(*keyPath)
+		} else {
+			var filePath string
+			filePath, err = plannedKeyfilePath()
 			checkError(err)
+			checkError(checkNotDir(filePath))
+			plan, err = dryRunPlan(filePath, keyOptions(*algo))
 		}
-	} else { // If there is no error, run the function useKey.
-		privKey, pubKey, err = useKey(filePath)
 		checkError(err)
+
+		fmt.Println(plan)
+		return
 	}
 
-	output, err := sign(input, pubKey, privKey)
-	checkError(err)
+	// A PEM bundle hands the public key to a verifier, there is no message to
+	// sign.
+	if *format == "pem-bundle" {
+		if flag.NArg() != 0 || *file != "" || *batch || *count != 0 || *jws || *cose || *onlySignature || *armor || *detached || *prehashed {
+			usageError("--format pem-bundle exports the public key without signing, please provide no message, --file, --batch, --count, --jws, --cose, --stdout-only-signature, --armor, --detached or --prehashed.")
+		}
+		if _, err := signer.HashSum(*hash, ""); err != nil {
+			usageError("%v.", err)
+		}
 
-	fmt.Println(output)
+		privKey, _, err := signingKey()
+		checkError(err)
 
-}
+		bundle, err := pemBundle(privKey.Public(), *hash, time.Now())
+		checkError(err)
 
-// The fullPath function takes in a directory path as a string and the name of a
-// file as a string and returns full path of the file as one string.
-func fullPath(dir, name string) string {
-	// This is used to make the directory of the file with Owner permissions only
-	// if it does not exist currently.
-	err := os.MkdirAll(dir, 0700)
+		// The bundle is PEM, which ends in a newline of its own.
+		checkError(withCode(errCodeIO, writeOutput(*outputFile, strings.TrimSuffix(bundle, "\n"))))
+		return
+	}
+
+	if *maxLen < 0 {
+		usageError("--max-len can not be negative, use 0 for no limit.")
+	}
+
+	var (
+		input    string
+		fileList io.ReadCloser
+	)
+
+	// The message comes from the argument, or from standard in when the
+	// argument is "-" or when there is no argument and standard in is piped.
+	switch {
+	case *messageFileList != "":
+		if *file != "" || *batch || *messageEnv != "" || *claims != "" || flag.NArg() != 0 {
+			usageError("--message-file-list reads the files to sign from the list, please provide no message, --file, --message-env, --claims or --batch.")
+		}
+		var err error
+		fileList, err = openFileList(*messageFileList)
+		checkError(err)
+	case *messageEnv != "":
+		if *file != "" || *batch || *claims != "" || flag.NArg() != 0 {
+			usageError("--message-env reads the message from the environment, please provide no message, --file, --claims or --batch.")
+		}
+		var err error
+		input, err = messageFromEnv(*messageEnv)
+		checkError(withCode(errCodeArgs, err))
+	case *claims != "":
+		if *file != "" || *batch || flag.NArg() != 0 {
+			usageError("--claims is what is signed, please provide no message, --file or --batch.")
+		}
+		canonical, err := signer.CanonicalClaims([]byte(*claims))
+		checkError(withCode(errCodeArgs, err))
+		input = string(canonical)
+	case *batch:
+		if *file != "" || flag.NArg() != 0 {
+			usageError("--batch reads the messages from standard in, please provide no message and no --file.")
+		}
+	case *file != "":
+		if flag.NArg() != 0 {
+			usageError("Please provide either --file or a message, not both.")
+		}
+		var err error
+		input, err = readMessageFile(*file)
+		checkError(err)
+	case flag.NArg() == 1 && flag.Arg(0) != "-":
+		input = flag.Arg(0)
+	case flag.NArg() == 1 || flag.NArg() == 0 && !stdinIsTerminal():
+		var err error
+		input, err = readMessage(os.Stdin)
+		checkError(err)
+	default:
+		usageError("%s", lengthUsage())
+	}
+
+	// Each file of a list gets a detached signature, so the same flags as
+	// --detached can not go with it.
+	if *messageFileList != "" && (*count != 0 || *jws || *cose || *format != "json" || *onlySignature || *armor || *detached ||
+		*prehashed || *truncate || signer.InputEncodingName(*inputEncoding) != signer.InputRaw || *ttl != 0 ||
+		signer.SigFormatName(*sigFormat) != signer.SigFormatDER || signer.SigEncodingName(*sigFormat, *sigEncoding) != signer.SigEncodingBase64 ||
+		signer.HashName(*hash) != "sha256") {
+		usageError("--message-file-list can not be combined with --count, --jws, --cose, --format, --stdout-only-signature, --armor, --detached, --prehashed, --truncate, --input-encoding, --ttl, --sig-format, --sig-encoding or --hash.")
+	}
+
+	// The count is checked before the key is loaded, or created.  0, the
+	// default, signs the message once as usual.
+	if *count < 0 || *count > maxCount {
+		usageError("--count must be between 0 and %d.", maxCount)
+	}
+	if *count > 0 && (*batch || *jws || *cose || *format != "json" || *onlySignature || *armor || *detached || *prehashed || *opensslHint) {
+		usageError("--count can not be combined with --batch, --jws, --cose, --format, --stdout-only-signature, --armor, --detached, --prehashed or --compat-openssl-verify-cmd.")
+	}
+
+	if *truncate && (*file != "" || *batch || *prehashed || signer.InputEncodingName(*inputEncoding) != signer.InputRaw) {
+		usageError("--truncate can not be combined with --file, --batch, --prehashed or --input-encoding.")
+	}
+
+	// Files have their own size limit, checked in readMessageFile, and each
+	// line of a batch is checked in signBatch.
+	truncated := false
+	if *file == "" {
+		if err := checkLength(input); err != nil {
+			if !*truncate {
+				usageError("The %v.  Please shorten it, raise --max-len or use --truncate.", err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: the %v, only the first %d are signed.\n", err, *maxLen)
+			input = truncateMessage(input, *maxLen)
+			truncated = true
+		}
+	}
+
+	if !*batch && *messageFileList == "" && checkEmpty(input) != nil {
+		usageError("The message is empty, use --allow-empty to sign it anyway.")
+	}
+
+	if *format != "json" && *format != "sigstore-ish" {
+		usageError("Unknown format %q, please use \"json\", \"sigstore-ish\" or \"pem-bundle\".", *format)
+	}
+
+	opts, err := optionsFromFlags()
+	checkError(withCode(errCodeArgs, err))
+	opts.Truncated = truncated
+	debugf("Signing options: hash %s, signature format %s, input encoding %s",
+		signer.HashName(opts.Hash), signer.SigFormatName(opts.SigFormat), signer.InputEncodingName(opts.InputEncoding))
+
+	// A malformed hex or Base64 message is caught before the key is loaded, or
+	// created.  Lines of a batch are checked as they are signed.
+	if !*batch && !opts.Prehashed {
+		if _, err := signer.DecodeMessage(input, opts.InputEncoding); err != nil {
+			usageError("The message can not be decoded: %v.", err)
+		}
+	}
+
+	// A digest is signed on its own, so nothing that is bound into the signed
+	// preimage, or that hashes the message itself, can go with it.
+	if opts.Prehashed {
+		if *file != "" || signer.InputEncodingName(opts.InputEncoding) != signer.InputRaw || opts.AAD != "" || opts.Nonce != "" ||
+			opts.ExpiresAt != 0 || *jws || *cose || *format != "json" || *onlySignature || *opensslHint {
+			usageError("--prehashed can not be combined with --file, --input-encoding, --aad, --nonce, --ttl, --jws, --cose, --format, --stdout-only-signature or --compat-openssl-verify-cmd.")
+		}
+		if !*batch {
+			if _, err := signer.ParseDigest(input, opts.Hash); err != nil {
+				usageError("The message is not a digest: %v.", err)
+			}
+		}
+	}
+
+	// The domain is signed, so it needs an output that carries it or a
+	// verifier that is given it.
+	if opts.Domain != "" && (*prehashed || *jws || *cose || *format != "json") {
+		usageError("--domain can not be combined with --prehashed, --jws, --cose or --format.")
+	}
+
+	// Bundles and the openssl command both expect the DER signature, Base64
+	// encoded.
+	defaultSig := signer.SigFormatName(opts.SigFormat) == signer.SigFormatDER &&
+		signer.SigEncodingName(opts.SigFormat, opts.SigEncoding) == signer.SigEncodingBase64
+	if !defaultSig && (*format == "sigstore-ish" || *opensslHint) {
+		usageError("--sig-format and --sig-encoding can only be used with the json format and without --compat-openssl-verify-cmd.")
+	}
+
+	// A JWS has its own layout, hash and signature format, and nowhere to put
+	// associated data.
+	if *jws && (*format != "json" || !defaultSig || opts.AAD != "" || opts.Nonce != "" || opts.ExpiresAt != 0 || *opensslHint) {
+		usageError("--jws can not be combined with --format, --sig-format, --sig-encoding, --aad, --nonce, --ttl or --compat-openssl-verify-cmd.")
+	}
+
+	// COSE_Sign1 has its own layout, hash and signature format, like a JWS,
+	// but its text encoding can be chosen.
+	if *cose && (*format != "json" || *jws || signer.SigFormatName(opts.SigFormat) != signer.SigFormatDER ||
+		opts.AAD != "" || opts.Nonce != "" || opts.ExpiresAt != 0 || *opensslHint || *batch || *onlySignature || *detached) {
+		usageError("--cose can not be combined with --format, --jws, --sig-format, --aad, --nonce, --ttl, --compat-openssl-verify-cmd, --batch, --stdout-only-signature or --detached.")
+	}
+
+	// Bundles have nowhere to write the nonce or the times of --ttl.
+	if *format == "sigstore-ish" && (opts.Nonce != "" || opts.ExpiresAt != 0) {
+		usageError("--nonce and --ttl can only be used with the json format.")
+	}
+
+	if *batch && (*format != "json" || *jws) {
+		usageError("--batch can only be used with the json format and without --jws.")
+	}
+
+	// The times of --ttl are needed to verify, and only the JSON has them.
+	if *onlySignature && (*format != "json" || *jws || *batch || opts.ExpiresAt != 0) {
+		usageError("--stdout-only-signature can not be combined with --format, --jws, --batch or --ttl.")
+	}
+
+	// The keyed digest is only recorded in the JSON and only checked by this
+	// tool, so formats read by other tools, and digests signed as they are,
+	// can not be keyed.
+	if len(opts.HMACKey) != 0 && (opts.Prehashed || *jws || *cose || *joseParts || *format != "json" || *messageFileList != "" || *opensslHint) {
+		usageError("--hmac-key can not be combined with --prehashed, --jws, --cose, --jose-parts, --format, --message-file-list or --compat-openssl-verify-cmd.")
+	}
+
+	// r and s are all that is printed, in the place of the JSON, and their hash
+	// is the one JOSE pairs with the curve.
+	if *joseParts && (*format != "json" || *jws || *cose || *batch || *messageFileList != "" || *count != 0 || *onlySignature ||
+		*armor || *detached || opts.Prehashed || !defaultSig || flagPassed("hash") || opts.ExpiresAt != 0 || *noPubKey || *noKeyInfo) {
+		usageError("--jose-parts can not be combined with --format, --jws, --cose, --batch, --message-file-list, --count, --stdout-only-signature, --armor, --detached, --prehashed, --sig-format, --sig-encoding, --hash, --ttl, --no-pubkey or --no-key-info.")
+	}
+
+	// A bundle always carries its public key, and the other forms have none.
+	if *noPubKey && (*format != "json" || *jws || *cose || *onlySignature) {
+		usageError("--no-pubkey can only be used with the json format, without --jws, --cose or --stdout-only-signature.")
+	}
+	if *noKeyInfo && (*format != "json" || *jws || *cose || *onlySignature) {
+		usageError("--no-key-info can only be used with the json format, without --jws, --cose or --stdout-only-signature.")
+	}
+	// Only the JSON has a place for the claims, and only this tool rebuilds
+	// their preimage.
+	if *claims != "" && (*format != "json" || *jws || *cose || *onlySignature || *armor || *detached || *joseParts || *prehashed || *truncate ||
+		signer.InputEncodingName(*inputEncoding) != signer.InputRaw || *opensslHint) {
+		usageError("--claims can only be used with the json format, without --jws, --cose, --stdout-only-signature, --armor, --detached, --jose-parts, --prehashed, --truncate, --input-encoding or --compat-openssl-verify-cmd.")
+	}
+	if *outDER && (*format != "json" || *jws || *cose || *onlySignature || *armor || *detached || *joseParts || *messageFileList != "" || *noPubKey) {
+		usageError("--out-der can only be used with the json format, without --jws, --cose, --stdout-only-signature, --armor, --detached, --jose-parts, --message-file-list or --no-pubkey.")
+	}
+	if *checksum && (*format != "json" || *jws || *cose || *onlySignature || *armor || *detached || *joseParts || *messageFileList != "") {
+		usageError("--checksum can only be used with the json format, without --jws, --cose, --stdout-only-signature, --armor, --detached, --jose-parts or --message-file-list.")
+	}
+
+	// Only JSON has a compact form, or an indent.
+	if (*compact || !*pretty || flagPassed("indent")) && (*jws || *cose || *onlySignature) {
+		usageError("--compact, --pretty and --indent can not be combined with --jws, --cose or --stdout-only-signature.")
+	}
+	if flagPassed("indent") && (*compact || !*pretty) {
+		usageError("--indent is for pretty JSON, it can not be combined with --compact or --pretty=false.")
+	}
+	if *indent < 0 || *indent > 8 {
+		usageError("--indent must be between 0 and 8.")
+	}
+
+	// An armored signature is the DER signature and its curve and hash, so
+	// nothing else the JSON would carry can go with it.
+	if *armor && *noArmor {
+		usageError("Please provide either --armor or --no-armor, not both.")
+	}
+	if *armor && (*format != "json" || *jws || *cose || *batch || *onlySignature || !defaultSig || opts.ExpiresAt != 0 ||
+		*noPubKey || *noKeyInfo || *compact || !*pretty || flagPassed("indent")) {
+		usageError("--armor can not be combined with --format, --jws, --cose, --batch, --stdout-only-signature, --sig-format, --sig-encoding, --ttl, --no-pubkey, --no-key-info, --compact, --pretty or --indent.")
+	}
+
+	// A detached signature is only the Base64 DER signature, so nothing the
+	// verifier would need the JSON for can go with it.
+	if *detached && (*file == "" || *format != "json" || *jws || *onlySignature || *outputFile != "" ||
+		!defaultSig || signer.HashName(opts.Hash) != "sha256" || opts.ExpiresAt != 0) {
+		usageError("--detached needs --file and can not be combined with --format, --jws, --stdout-only-signature, --output, --sig-format, --sig-encoding, --hash or --ttl.")
+	}
+
+	// The preimage is that of one plain signature, so each salt of --count,
+	// each line or file of a list, and the signing inputs of a digest, a JWS
+	// or COSE_Sign1 have none to show.
+	if *showPreimage && (*batch || *messageFileList != "" || *count != 0 || opts.Prehashed || *jws || *cose) {
+		usageError("--show-preimage can not be combined with --batch, --message-file-list, --count, --prehashed, --jws or --cose.")
+	}
+
+	// The OpenSSL instructions come with the preimage to save, so they are for
+	// one message too.
+	if *opensslHint && (*batch || *messageFileList != "") {
+		usageError("--compat-openssl-verify-cmd can not be combined with --batch or --message-file-list.")
+	}
+
+	// A detached signature goes next to the file it signs, which is left as it
+	// is.  The output is checked before the key is loaded, or created, so an
+	// --output that can not be written costs nothing.
+	outPath := *outputFile
+	if *detached {
+		outPath = *file + ".sig"
+		verbosef("Writing the signature to %s", outPath)
+	}
+	target, err := openOutput(outPath)
+	checkError(withCode(errCodeIO, err))
+
+	keyStart := time.Now()
+	privKey, pubKey, err := signingKey()
 	checkError(err)
+	timeStage("key load", keyStart)
 
-	// Joins the directory and file name into one string and returns it.
-	fullPath := path.Join(dir, name)
-	return fullPath
+	if *algo != "" && signer.KeyAlgorithm(privKey) != *algo {
+		usageError("The saved key pair is %s, not %s.", signer.KeyAlgorithm(privKey), *algo)
+	}
+
+	if *curve != "" {
+		key, ok := privKey.Public().(*ecdsa.PublicKey)
+		if !ok {
+			usageError("The saved key pair is %s, --curve can only be used with ECDSA keys.", signer.KeyAlgorithm(privKey))
+		}
+		if signer.CurveName(key) != *curve {
+			usageError("The saved key pair is on curve %s, not %s.", signer.CurveName(key), *curve)
+		}
+	}
+
+	if signer.KeyAlgorithm(privKey) == signer.AlgoEd25519 && opts.Prehashed {
+		usageError("Ed25519 signs the message itself, --prehashed can only be used with ECDSA keys.")
+	}
+
+	if signer.KeyAlgorithm(privKey) == signer.AlgoEd25519 && len(opts.HMACKey) != 0 {
+		usageError("Ed25519 signs the message itself, --hmac-key can only be used with ECDSA keys.")
+	}
+
+	if signer.KeyAlgorithm(privKey) == signer.AlgoEd25519 && *joseParts {
+		usageError("Ed25519 signatures have no r and s, --jose-parts can only be used with ECDSA keys.")
+	}
+
+	if signer.KeyAlgorithm(privKey) == signer.AlgoEd25519 && signer.HashName(opts.Hash) != "sha256" && !*jws && !*cose {
+		usageError("Ed25519 signs the message itself, --hash can not be used with it.")
+	}
+
+	// JOSE pairs each curve with one hash, ES512 is P-521 with SHA512.  Other
+	// pairs still verify, so a hash chosen with --hash that does not match is
+	// only warned about, but under --strict any pair that does not match,
+	// the default SHA256 with P-521 too, is refused.  A JWS, COSE_Sign1 or the
+	// parts of --jose-parts always use the matching hash.
+	//
+	// A digest longer than the order of the curve is cut short before it is
+	// signed, which is warned about whenever it happens, and refused under
+	// --strict, and takes the place of the warning about the pair.
+	if err := signer.CheckDigestSize(privKey.Public(), opts.Hash); err != nil && !*jws && !*cose && !*joseParts {
+		if *strict {
+			usageError("The curve can not sign the whole digest: %v, please choose a shorter hash with --hash.", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v.\n", err)
+	} else if err := signer.CheckHashCurve(privKey.Public(), opts.Hash); err != nil && !*jws && !*cose && !*joseParts {
+		if *strict {
+			usageError("The hash does not match the key: %v, please choose it with --hash.", err)
+		}
+		if flagPassed("hash") {
+			fmt.Fprintf(os.Stderr, "Warning: %v.\n", err)
+		}
+	}
+
+	verbosef("Signing with the %s key", signer.KeyDescription(privKey.Public()))
+	if signer.KeyAlgorithm(privKey) == signer.AlgoECDSA && !*jws && !*cose && !*joseParts {
+		if opts.Prehashed {
+			verbosef("Signing the %s digest given as the message", signer.HashName(opts.Hash))
+		} else {
+			verbosef("Signing the %s digest of the message", signer.HashName(opts.Hash))
+		}
+	}
+
+	// Lines of a batch, or files of a list, that can not be signed are reported
+	// as they are found, and make the program exit non-zero once the rest are
+	// written.
+	var (
+		output string
+		failed int
+	)
+	if *batch {
+		output, failed, err = signBatch(os.Stdin, privKey, opts, *failFast, os.Stderr)
+	} else if fileList != nil {
+		output, failed, err = signFileList(fileList, privKey, opts, *failFast, os.Stderr)
+		fileList.Close()
+	} else if *count > 0 {
+		output, err = signCount(input, privKey, opts, *count)
+	} else if *jws {
+		output, err = jwsSign(input, privKey, opts)
+	} else if *joseParts {
+		output, err = josePartsSign(input, privKey, opts)
+	} else if *cose {
+		output, err = coseSign(input, privKey, opts)
+	} else if *format == "sigstore-ish" {
+		output, err = sigstoreSign(input, pubKey, privKey, opts)
+	} else if *armor {
+		output, err = signatureArmored(input, privKey, opts)
+		// The block is PEM, which ends in a newline of its own.
+		output = strings.TrimSuffix(output, "\n")
+	} else if *onlySignature || *detached {
+		output, err = signatureOnly(input, privKey, opts)
+	} else {
+		output, err = sign(input, privKey, opts)
+	}
+	checkError(withCode(errCodeSign, err))
+
+	// Nothing is written until the signing succeeded, so a failed run leaves an
+	// earlier output file as it was.
+	err = target.write(output)
+	checkError(withCode(errCodeIO, err))
+
+	if *opensslHint {
+		fmt.Fprint(os.Stderr, opensslVerifyHint(privKey.Public(), signer.HashName(opts.Hash)))
+	}
+
+	if *showPreimage || *opensslHint {
+		checkError(writePreimage(os.Stderr, input, opts))
+	}
+
+	if *timings {
+		writeTimings(os.Stderr)
+	}
+
+	if failed > 0 {
+		os.Exit(exitError)
+	}
 }
 
-// The createSaveKey function takes in the file path where you want to save the
-// eventualy created key pair to in one string and returns an ECDSA private key,
-// and the ECDSA public key in a PEM formatted string, or an error if there is one.
-func createSaveKey(filePath string) (*ecdsa.PrivateKey, string, error) {
-	// Create the file with Owner read/write permission, open it, and defer closing.
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
+// The signatureOnly function takes in the same arguments as sign and returns
+// only the signature from the output of sign, in the format of --sig-format,
+// or an error if there is one.
+func signatureOnly(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	out, err := signer.Sign(input, privKey, opts)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
-	defer file.Close()
 
-	// Intialize variable privateKey as a new ECDSA private key then generate
-	// the private key using the elliptic curve P521 and reading from random and
-	// set it to privateKey.
-	privateKey := new(ecdsa.PrivateKey)
-	privateKey, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
-	if err != nil {
-		return nil, "", err
+	return out.Signature, nil
+}
+
+// The checkLength function takes in a message and returns an error if it has
+// more characters than --max-len allows.  Characters are counted, not bytes, so
+// a message in any language gets the same limit.
+func checkLength(input string) error {
+	length := utf8.RuneCountInString(input)
+	if *maxLen > 0 && length > *maxLen {
+		return fmt.Errorf("message is %d characters, the limit is %d", length, *maxLen)
 	}
+	return nil
+}
 
-	// Intialize variable pubKey as a ECDSA public key type then set pubKey to
-	// the Public Key that corresponds to the Private Key generated earlier (privateKey)
-	var pubKey ecdsa.PublicKey
-	pubKey = privateKey.PublicKey
+// The truncateMessage function takes in a message and a number of characters,
+// and returns the first that many characters of the message.  Characters are
+// counted as checkLength counts them, so a multibyte character is never split.
+func truncateMessage(input string, length int) string {
+	for i := range input {
+		if length == 0 {
+			return input[:i]
+		}
+		length--
+	}
+	return input
+}
 
-	// The MarshalPKIXPublicKey function from the x509 package requires a pointer
-	// to a public key(&pubKey) then serialises it to DER-encoded PKIX format
-	// which is returned as a slice of bytes(pemPubSlice) or returns an error (err)
-	pemPubSlice, err := x509.MarshalPKIXPublicKey(&pubKey)
-	if err != nil {
-		return nil, "", err
+// The checkEmpty function takes in a message and returns an error if it is
+// empty and --allow-empty is not given.  An empty message is almost always a
+// mistake, such as an unset shell variable, rather than something to sign.
+func checkEmpty(input string) error {
+	if input == "" && !*allowEmpty {
+		return errors.New("message is empty, use --allow-empty to sign it anyway")
 	}
+	return nil
+}
+
+// The lengthUsage function returns the message asking for one argument, with
+// the limit --max-len sets on its length.
+func lengthUsage() string {
+	if *maxLen == 0 {
+		return "Please provide one argument."
+	}
+	return fmt.Sprintf("Please provide one argument that is %d characters or less.", *maxLen)
+}
 
-	// Create PEM encoded structure(Block) with the form:
-	/*
-		-----BEGIN Type-----
-		base64-encoded Bytes
-		-----END Type-----
-	*/
-	// where Type = "PUBLIC KEY" and the bytes to be encoded to base64 are pemPubSlice
-	var pemPubKey = &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: pemPubSlice}
+// The flagPassed function takes in the name of a flag and returns true if it
+// was given on the command line, rather than left at its default.
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
 
-	// This sets the PEM block (pemPubKey) to a variable (encPubPem) to be used later.
-	encPubPem := pem.EncodeToMemory(pemPubKey)
+// The optionsFromFlags function returns the signer.Options chosen by the
+// command line flags or an error if the flags conflict.
+func optionsFromFlags() (signer.Options, error) {
+	var opts signer.Options
 
-	// The next section encodes the private key to PEM format just like the public
-	// key was encoded earlier and then it is set to a variable as well.
-	pemPrivSlice, err := x509.MarshalECPrivateKey(privateKey)
-	if err != nil {
-		return nil, "", err
+	opts.EncodeMessage = *file != ""
+
+	// A file is signed as the bytes it holds, there is no text to decode.
+	opts.InputEncoding = *inputEncoding
+	if *file != "" && signer.InputEncodingName(opts.InputEncoding) != signer.InputRaw {
+		return opts, errors.New("--input-encoding can not be used with --file")
+	}
+	if _, err := signer.DecodeMessage("", opts.InputEncoding); err != nil {
+		return opts, err
+	}
+
+	opts.Hash = *hash
+	opts.Deterministic = *deterministic
+	opts.LowS = *lowS
+	if *hmacKey != "" {
+		key, err := hex.DecodeString(*hmacKey)
+		if err != nil {
+			return opts, fmt.Errorf("--hmac-key is not hex: %v", err)
+		}
+		opts.HMACKey = key
+	}
+	opts.Prehashed = *prehashed
+	if _, err := signer.HashSum(opts.Hash, ""); err != nil {
+		return opts, err
+	}
+
+	opts.SigFormat = *sigFormat
+	if err := signer.CheckSigFormat(opts.SigFormat); err != nil {
+		return opts, err
+	}
+
+	opts.SigEncoding = *sigEncoding
+	if err := signer.CheckSigEncoding(opts.SigEncoding); err != nil {
+		return opts, err
+	}
+
+	opts.Nonce = *nonce
+	if *timings {
+		opts.Timing = recordStage
 	}
-	var pemPrivKey = &pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: pemPrivSlice}
+	opts.Domain = *domain
+	opts.OmitPubKey = *noPubKey
+	opts.OmitKeyInfo = *noKeyInfo
+	opts.Checksum = *checksum
+	opts.PubKeyDER = *outDER
+	opts.Claims = *claims != ""
 
-	encPrivPem := pem.EncodeToMemory(pemPrivKey)
+	if *ttl < 0 {
+		return opts, errors.New("--ttl can not be negative")
+	}
+	if *ttl > 0 {
+		now := time.Now()
+		opts.IssuedAt = now.Unix()
+		opts.ExpiresAt = now.Add(*ttl).Unix()
+	}
+
+	opts.AAD = *aad
+	if *aadEnv != "" {
+		if *aad != "" {
+			return opts, errors.New("use only one of --aad and --aad-env")
+		}
 
-	// This writes the PEM encoded private key and public key as strings to the
-	// file created earlier.
-	file.WriteString(string(encPrivPem))
-	file.WriteString(string(encPubPem))
+		value, ok := os.LookupEnv(*aadEnv)
+		if !ok {
+			return opts, fmt.Errorf("environment variable %s is not set", *aadEnv)
+		}
+		opts.AAD = value
+	}
 
-	// Return the ECDSA private key created earlier, the string of the PEM encoded
-	// public key, and no error.
-	return privateKey, string(encPubPem), nil
+	return opts, nil
 }
 
-// The useKey function takes in the file path of the file where the private and
-// public key pair are saved in PEM format and returns an ECDSA private key and
-// the ECDSA public key in a PEM formatted string, or an error if there is one.
-func useKey(filePath string) (*ecdsa.PrivateKey, string, error) {
-	// Reads the entire file and saves the contents as a string or returns error.
-	contents, err := ioutil.ReadFile(filePath)
+// The stdinIsTerminal function returns true if standard in is a terminal rather
+// than a pipe or a file.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
 	if err != nil {
-		return nil, "", err
+		return true
 	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Decodes the contents into 2 variables (block & rest); setting block to the
-	// first PEM block contained in contents.
-	// Here we are assuming the contents of the file are an ECDSA private key PEM
-	// block and the corresponding ECDSA public key PEM block as that is how the
-	// file was originally created.  A check could be added later to make sure
-	// the contents of (rest) is a valid *ecdsa.PublicKey.
-	block, rest := pem.Decode(contents)
-
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+// The readMessage function takes in a reader and returns everything read from
+// it as the message to sign, or an error if there is one.  A single trailing
+// newline ("\n" or "\r\n"), such as the one echo adds, is removed and is not
+// part of what gets signed.  Any other whitespace is kept.
+func readMessage(r io.Reader) (string, error) {
+	contents, err := io.ReadAll(r)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
 
-	publicKey := string(rest)
+	input := strings.TrimSuffix(string(contents), "\n")
+	if len(input) < len(contents) {
+		input = strings.TrimSuffix(input, "\r")
+	}
 
-	return privateKey, publicKey, nil
+	return input, nil
 }
 
-// The sign function takes in the input as a string, the public key as a string
-// of PEM format, and the ECDSA private key.  It returns a JSON formatted string
-// containing the input message, the Base64 encoded signature of the message,
-// and the ECDSA public key in PEM format or an error if there is one.
-func sign(input, pubKey string, privKey *ecdsa.PrivateKey) (string, error) {
+// The messageFromEnv function takes in the name of an environment variable and
+// returns its value as the message to sign, or an error if it is not set or is
+// empty.
+func messageFromEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s, given to --message-env, is not set", name)
+	}
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s, given to --message-env, is empty", name)
+	}
+	return value, nil
+}
 
-	// Create an ECDSA signature using the given private key, the SHA256 of the
-	// given input, and reading from random or return an error.
-	r, s, err := ecdsa.Sign(rand.Reader, privKey, shaSum(input))
+// The readMessageFile function takes in the path of a file and returns its
+// contents, byte for byte, as the message to sign or an error if the file can
+// not be read or is larger than maxFileSize.
+func readMessageFile(filePath string) (string, error) {
+	info, err := os.Stat(filePath)
 	if err != nil {
 		return "", err
 	}
 
-	// Encode the signature using ASN.1 format and set it to variable (sign) or
-	// return an error.
-	sign, err := asn1.Marshal(ecdsaSig{r, s})
+	if info.Size() > maxFileSize {
+		return "", fmt.Errorf("%s is %d bytes, the largest file that can be signed is %d bytes",
+			filePath, info.Size(), maxFileSize)
+	}
+
+	contents, err := os.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
 
-	// Convert the ASN.1 encoded signature to Base64 encoding and return it as
-	// a string
-	encSign := base64.StdEncoding.EncodeToString(sign)
-
-	// Intialize an output struct and set the fields input string, the Base64
-	// encoded signature string, and the public key (in PEM format) string.
-	var out output
-	out.Message = input
-	out.Signature = encSign
-	out.PubKey = pubKey
+	return string(contents), nil
+}
 
-	// JSON format the struct (out) and make it so the fields are tabbed in
-	outJSON, err := json.MarshalIndent(out, "", "    ")
+// The keyfilePath function returns the path of the key pair file: the --keyfile
+// flag if it was given, otherwise the keyfileEnv environment variable if it is
+// set, otherwise the keyfile of the config file if it has one, otherwise
+// keyfile in dir under the home directory.  The directory
+// holding the file is created with Owner permissions only if it does not
+// exist.  It returns an error if the home directory is needed but unknown, or
+// if there is a directory at the path.
+func keyfilePath() (string, error) {
+	filePath, err := plannedKeyfilePath()
 	if err != nil {
 		return "", err
 	}
 
-	// Return the string of the JSON formatted struct and no error.
-	return string(outJSON), nil
+	if err := checkNotDir(filePath); err != nil {
+		return "", err
+	}
+
+	return fullPath(filepath.Dir(filePath), filepath.Base(filePath))
+}
+
+// The checkNotDir function takes in the path of the key pair file and returns
+// an error if there is a directory at that path, which could never be read or
+// written as the key pair file.  A path with nothing at it is fine.
+func checkNotDir(filePath string) error {
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		return withCode(errCodeIO, fmt.Errorf("keyfile path %s is a directory, please give the path of a file with --keyfile or %s", filePath, keyfileEnv))
+	}
+	return nil
+}
+
+// The plannedKeyfilePath function returns the path of the key pair file as
+// keyfilePath does, but never creates its directory.
+func plannedKeyfilePath() (string, error) {
+	filePath := *keyfileFlag
+	if filePath != "" {
+		debugf("The key pair file %s is chosen with --keyfile", filePath)
+		return filePath, nil
+	}
+
+	filePath = os.Getenv(keyfileEnv)
+	if filePath != "" {
+		debugf("The key pair file %s is chosen with %s", filePath, keyfileEnv)
+		return filePath, nil
+	}
+
+	if configKeyfile != "" {
+		debugf("The key pair file %s is chosen in the config file", configKeyfile)
+		return configKeyfile, nil
+	}
+
+	// os.UserHomeDir is $HOME on Unix and %USERPROFILE% on Windows.
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("can not find the home directory, use --keyfile or %s to choose where the key pair is kept: %v",
+			keyfileEnv, err)
+	}
+
+	filePath = filepath.Join(home, dir, keyfile)
+	debugf("The key pair file %s is the default under the home directory", filePath)
+	return filePath, nil
+}
+
+// The fullPath function takes in a directory path as a string and the name of a
+// file as a string and returns full path of the file as one string, or an
+// error if the directory can not be created.
+func fullPath(dir, name string) (string, error) {
+	// This is used to make the directory of the file with Owner permissions only
+	// if it does not exist currently.
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", mkdirError(dir, err)
+	}
+
+	// Joins the directory and file name into one string and returns it.
+	fullPath := filepath.Join(dir, name)
+	return fullPath, nil
+}
+
+// The mkdirError function takes in the directory the key pair is kept in and
+// the error creating it.  When the directory can not be made where it is, for
+// example because the home directory is read-only, missing or a file, it
+// returns an error saying how to keep the key pair elsewhere.  Any other
+// error is returned with the directory added.
+func mkdirError(dir string, err error) error {
+	// The path is already in the message, so only the reason is kept.
+	cause := err
+	if pathErr, ok := err.(*os.PathError); ok {
+		cause = pathErr.Err
+	}
+
+	if os.IsPermission(err) || os.IsNotExist(err) || errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.ENOTDIR) {
+		return fmt.Errorf("can not create %s to keep the key pair in (%v), use --keyfile or %s to keep it somewhere you can write",
+			dir, cause, keyfileEnv)
+	}
+	return fmt.Errorf("can not create %s: %v", dir, err)
+}
+
+// The keyFS is what key pair and key files are read from, the disk when it is
+// nil.  Tests set it to read keyfiles from memory.
+var keyFS signer.FileSystem
+
+// The keyOptions function takes in the key algorithm to use if a new key pair
+// has to be created and returns the signer.KeyOptions chosen by the command
+// line flags.
+func keyOptions(algo string) signer.KeyOptions {
+	return signer.KeyOptions{
+		Algorithm:  algo,
+		Curve:      *curve,
+		PKCS8:      *pkcs8,
+		Encrypt:    *encryptKey,
+		Passphrase: readPassphrase,
+		Identity:   *identity,
+		Logf:       verbosef,
+		FS:         keyFS,
+
+		Mode:              os.FileMode(keyfileMode),
+		AllowInsecureMode: *allowInsecurePerms,
+	}
 }
 
-// The shaSum function takes the input as a string and returns a SHA256 digest
-// of the input.
-func shaSum(input string) []byte {
-	// The input is converted into a slice of bytes, runs a SHA256 hash algorithm,
-	// then returns the SHA256 checksum of that slice, and returns it as an array
-	// of [size]byte (inputShaSum).
-	inputShaSum := sha256.Sum256([]byte(input))
+// The signingKey function returns the private key to sign with and the public
+// key in a PEM formatted string: the key in the file given with --key, or the
+// key pair in the key pair file, created first if there is none or if --new is
+// given.  It returns an error if there is one.
+func signingKey() (crypto.Signer, string, error) {
+	if *keyPath == "" {
+		filePath, err := keyfilePath()
+		if err != nil {
+			return nil, "", withCode(errCodeIO, err)
+		}
+
+		if *newKey {
+			return newKeyPair(filePath)
+		}
+		return loadOrCreateKey(filePath, *algo)
+	}
+
+	// A key brought with --key is never created, so there is nothing for
+	// --keyfile, --encrypt or --new to do.
+	if *keyfileFlag != "" || *encryptKey || *identity != "" || *newKey {
+		usageError("--key can not be combined with --keyfile, --encrypt, --identity or --new.")
+	}
+
+	verbosef("Loading the private key from %s", *keyPath)
+	return keyOptions("").LoadPrivateKey(*keyPath)
+}
 
-	// Make a new slice of bytes with length equal to the length of inputShaSum
-	inputSlice := make([]byte, len(inputShaSum))
+// The loadOrCreateKey function takes in the file path of the key pair file and
+// the key algorithm to use if a new key pair has to be created.  It returns the
+// private key and the public key in a PEM formatted string, creating and saving
+// a new key pair first if the file does not exist, or an error if there is one.
+// A new key pair is reported on standard error with its fingerprint, and an
+// existing file with looser permissions than expected is warned about, or
+// refused with --strict-perms.
+func loadOrCreateKey(filePath, algo string) (crypto.Signer, string, error) {
+	if err := checkKeyfilePerms(filePath); err != nil {
+		return nil, "", err
+	}
 
-	// At each index in inputShaSum, set the value at the same index in inputSlice
-	// equal to the value at that index in inputShaSum
-	// inputSlice becomes a slice of bytes with the same data as inputShaSum and
-	// is still a cryptographic hash
-	for i := range inputShaSum {
-		inputSlice[i] = inputShaSum[i]
+	o := keyOptions(algo)
+	o.Created = func(privKey crypto.Signer) {
+		if fp, err := signer.Fingerprint(privKey.Public()); err == nil {
+			logNewIdentity(fp)
+		}
 	}
+	privKey, pubKey, err := o.LoadOrCreate(filePath)
+	return privKey, pubKey, insecureModeHint(err)
+}
 
-	// Return the SHA256 digest of the input (inputSlice)
-	return inputSlice
+// The logNewIdentity function takes in the fingerprint of a key pair that was
+// just created and reports it on standard error, so the new identity can be
+// recorded.  Standard out is left to the signed message.
+func logNewIdentity(fp string) {
+	fmt.Fprintf(os.Stderr, "Created new identity %s\n", fp)
 }
 
-// The checkError function takes in an error and checks if it is not equal to
-// nil, and if it is not then it logs the error to standard out and exits the
-// program with a non-zero code.
-func checkError(err error) {
+// The createSaveKey function takes in the file path where you want to save the
+// eventualy created key pair to in one string, the key algorithm and the source
+// of random bytes to make the key from, and returns the private key, the
+// public key in a PEM formatted string and the SHA256 fingerprint of the
+// public key, as the fingerprint command prints it, or an error if there is
+// one.  The tool passes crypto/rand.Reader, tests can pass a fixed source.
+func createSaveKey(filePath, algo string, random io.Reader) (crypto.Signer, string, string, error) {
+	o := keyOptions(algo)
+	o.Rand = random
+	privKey, pubKey, err := o.Create(filePath)
+	if err != nil {
+		return nil, "", "", insecureModeHint(err)
+	}
+
+	fp, err := signer.Fingerprint(privKey.Public())
 	if err != nil {
-		log.Fatal(err)
+		return nil, "", "", err
+	}
+	return privKey, pubKey, fp, nil
+}
+
+// The saveKey function takes in the file path where you want to save the key
+// pair and the private key.  It writes the private key and its public key to
+// the file in PEM format and returns the public key in a PEM formatted string,
+// or an error if there is one.
+func saveKey(filePath string, privateKey crypto.Signer) (string, error) {
+	pubKey, err := keyOptions("").Save(filePath, privateKey)
+	return pubKey, insecureModeHint(err)
+}
+
+// The useKey function takes in the file path of the file where the private and
+// public key pair are saved in PEM format and returns the private key and the
+// public key in a PEM formatted string, or an error if there is one.  It warns
+// if the file has looser permissions than expected, or refuses it with
+// --strict-perms.
+func useKey(filePath string) (crypto.Signer, string, error) {
+	if err := checkKeyfilePerms(filePath); err != nil {
+		return nil, "", err
 	}
+
+	return keyOptions("").Load(filePath)
 }
 
-// The output struct is used to hold 3 strings and provide JSON specific tags
-// for each string.
-type output struct {
-	Message   string `json:"message"`
-	Signature string `json:"signature"`
-	PubKey    string `json:"pubkey"`
+// The sign function takes in the input as a string, the private key, and the
+// signer.Options.  It returns a JSON formatted string containing the input
+// message, the Base64 encoded signature of the message, and the public key in
+// PEM format or an error if there is one.  The signature is made with the
+// random source in the Rand of the options, crypto/rand.Reader when it is nil.
+func sign(input string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	out, err := signer.Sign(input, privKey, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// JSON format the struct (out) and make it so the fields are tabbed in,
+	// unless --compact is given.
+	outJSON, err := marshalJSON(out)
+	if err != nil {
+		return "", err
+	}
+
+	// Return the string of the JSON formatted struct and no error.
+	return string(outJSON), nil
 }
 
-// The ecdsaSig struct is used to hold 2 *big.Int so than when a ECDSA signature
-// is created, the 2 returned *big.Int can be stored to verify the signature if
-// needed.
-type ecdsaSig struct {
-	R, S *big.Int
+// The marshalJSON function takes in a value and returns its JSON encoding,
+// indented with four spaces, or as many as --indent gives, or on one line with
+// no spaces if --compact or --pretty=false is given, or an error saying the
+// JSON could not be marshaled.  Struct fields are written in the order
+// they are declared in, so the compact encoding of a value is always the same.
+func marshalJSON(v interface{}) ([]byte, error) {
+	defer timeStage("marshal", time.Now())
+
+	var (
+		outJSON []byte
+		err     error
+	)
+	if *compact || !*pretty {
+		outJSON, err = json.Marshal(v)
+	} else {
+		outJSON, err = json.MarshalIndent(v, "", strings.Repeat(" ", *indent))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshaling JSON: %w", err)
+	}
+	return outJSON, nil
 }
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/x509"
-	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"os"
+	"path"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
 )
 
 const keys = `
@@ -37,71 +44,475 @@ func keyContents() (*ecdsa.PrivateKey, string) {
 	return privateKey, publicKey
 }
 
-func TestMessage(t *testing.T) {
-	privKey, pubKey := keyContents()
-	signed, err := sign("Hello", pubKey, privKey)
+func TestProtect(t *testing.T) {
+	crash := func() {
+		var block *pem.Block
+		_ = block.Bytes
+	}
+
+	var (
+		buf       bytes.Buffer
+		debugMode bool
+	)
+
+	code := protect(&buf, &debugMode, crash)
+	if code != exitPanic {
+		t.Errorf("Exit code is %d, expected %d.", code, exitPanic)
+	}
+	if !strings.Contains(buf.String(), "Unexpected error") {
+		t.Errorf("Missing error message: %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "goroutine") {
+		t.Error("Stack trace printed without --debug.")
+	}
+
+	buf.Reset()
+	debugMode = true
+
+	code = protect(&buf, &debugMode, crash)
+	if code != exitPanic {
+		t.Errorf("Exit code is %d, expected %d.", code, exitPanic)
+	}
+	if !strings.Contains(buf.String(), "goroutine") {
+		t.Error("Stack trace missing with --debug.")
+	}
+
+	if protect(&buf, &debugMode, func() {}) != 0 {
+		t.Error("A function that did not panic returned a non-zero code.")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := map[string]string{
+		"Hello":        "Hello",
+		"Hello\n":      "Hello",
+		"Hello\r\n":    "Hello",
+		"Hello\n\n":    "Hello\n",
+		"Hello \n":     "Hello ",
+		"Hello\r":      "Hello\r",
+		"":             "",
+		"line1\nline2": "line1\nline2",
+	}
+
+	for in, expected := range tests {
+		input, err := readMessage(strings.NewReader(in))
+		if err != nil {
+			t.Errorf("Error reading %q: %v", in, err)
+		}
+		if input != expected {
+			t.Errorf("Read %q from %q, expected %q.", input, in, expected)
+		}
+	}
+}
+
+func TestKeyfilePathUnwritable(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv(keyfileEnv, "")
+
+	// A home directory that is a file can never hold the key pair directory,
+	// even for root.
+	home := path.Join(base, "home")
+	err := os.WriteFile(home, nil, 0600)
 	if err != nil {
-		t.Errorf("Error signing message: %v", err)
+		t.Fatal(err)
 	}
+	t.Setenv("HOME", home)
 
-	var out output
+	_, err = keyfilePath()
+	if err == nil || !strings.Contains(err.Error(), "use --keyfile or "+keyfileEnv) {
+		t.Errorf("A home directory that is a file gave %v, expected a hint to use --keyfile.", err)
+	}
 
-	err = json.Unmarshal([]byte(signed), &out)
+	// Root can write anywhere, so a read-only directory only stops others.
+	if os.Geteuid() == 0 {
+		return
+	}
+
+	readOnly := path.Join(base, "readonly")
+	err = os.Mkdir(readOnly, 0500)
 	if err != nil {
-		t.Errorf("Error unmarshaling json: %v", err)
+		t.Fatal(err)
 	}
+	t.Setenv("HOME", readOnly)
 
-	if out.Message != "Hello" {
-		t.Error("Input message does not equal output message.")
+	_, err = keyfilePath()
+	if err == nil || !strings.Contains(err.Error(), "use --keyfile or "+keyfileEnv) {
+		t.Errorf("A read-only home directory gave %v, expected a hint to use --keyfile.", err)
 	}
 }
 
-func TestValidSignature(t *testing.T) {
-	privKey, pubKey := keyContents()
-	signed, err := sign("Hello", pubKey, privKey)
+func TestKeyfilePath(t *testing.T) {
+	base := t.TempDir()
+	envPath := path.Join(base, "env", "keys.pem")
+	flagPath := path.Join(base, "flag", "nested", "keys.pem")
+
+	home := path.Join(base, "home")
+	t.Setenv("HOME", home)
+	t.Setenv(keyfileEnv, "")
+	if p, _ := keyfilePath(); p != path.Join(home, ".local/share/signer/keypair.txt") {
+		t.Errorf("Key pair file is %s, expected the default under %s.", p, home)
+	}
+
+	t.Setenv(keyfileEnv, envPath)
+	if p, _ := keyfilePath(); p != envPath {
+		t.Errorf("Key pair file is %s, expected %s from the environment.", p, envPath)
+	}
+
+	*keyfileFlag = flagPath
+	defer func() { *keyfileFlag = "" }()
+
+	if p, _ := keyfilePath(); p != flagPath {
+		t.Errorf("Key pair file is %s, expected %s from the flag.", p, flagPath)
+	}
+
+	info, err := os.Stat(path.Dir(flagPath))
 	if err != nil {
-		t.Errorf("Error signing message: %v", err)
+		t.Fatalf("The key pair directory was not created: %v", err)
 	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("The key pair directory has mode %o, expected 700.", info.Mode().Perm())
+	}
+}
 
-	var out output
+func TestWriteOutput(t *testing.T) {
+	outPath := path.Join(t.TempDir(), "signed.json")
 
-	err = json.Unmarshal([]byte(signed), &out)
+	err := os.WriteFile(outPath, []byte("an older, longer signed message\n"), 0644)
 	if err != nil {
-		t.Errorf("Error unmarshaling json: %v", err)
+		t.Fatal(err)
 	}
 
-	decSign, err := base64.StdEncoding.DecodeString(out.Signature)
+	err = writeOutput(outPath, `{"message": "Hello"}`)
 	if err != nil {
-		t.Errorf("Error decoding signature: %v", err)
+		t.Fatalf("Error writing output: %v", err)
 	}
 
-	var sign ecdsaSig
+	contents, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "{\"message\": \"Hello\"}\n" {
+		t.Errorf("Output file holds %q, expected the new message only.", contents)
+	}
 
-	_, err = asn1.Unmarshal(decSign, &sign)
+	info, err := os.Stat(outPath)
 	if err != nil {
-		t.Errorf("Error unmarshaling decoded signature: %v", err)
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("The output file has mode %o, expected 600.", info.Mode().Perm())
+	}
+}
+
+func TestOutputLayout(t *testing.T) {
+	outPath := path.Join(t.TempDir(), "signed.json")
+	defer func() {
+		*pretty = true
+		*indent = 4
+		*noNewline = false
+	}()
+
+	value := map[string]string{"message": "Hello"}
+
+	layouts := []struct {
+		pretty    bool
+		indent    int
+		noNewline bool
+		expected  string
+	}{
+		{true, 4, false, "{\n    \"message\": \"Hello\"\n}\n"},
+		{true, 2, false, "{\n  \"message\": \"Hello\"\n}\n"},
+		{true, 0, true, "{\n\"message\": \"Hello\"\n}"},
+		{false, 4, false, "{\"message\":\"Hello\"}\n"},
+		{false, 4, true, "{\"message\":\"Hello\"}"},
+	}
+
+	for _, layout := range layouts {
+		*pretty = layout.pretty
+		*indent = layout.indent
+		*noNewline = layout.noNewline
+
+		outJSON, err := marshalJSON(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeOutput(outPath, string(outJSON)); err != nil {
+			t.Fatal(err)
+		}
+
+		contents, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != layout.expected {
+			t.Errorf("With --pretty=%t --indent %d --no-newline=%t the output is %q, expected %q.",
+				layout.pretty, layout.indent, layout.noNewline, contents, layout.expected)
+		}
 	}
+}
 
-	if !ecdsa.Verify(&privKey.PublicKey, shaSum("Hello"), sign.R, sign.S) {
-		t.Error("The signature is not valid.")
+func TestCheckLength(t *testing.T) {
+	defer func() { *maxLen = 250 }()
+
+	// 250 characters, but 750 bytes.
+	if err := checkLength(strings.Repeat("日", 250)); err != nil {
+		t.Errorf("A 250 character multibyte message was rejected: %v", err)
+	}
+	if err := checkLength(strings.Repeat("a", 251)); err == nil {
+		t.Error("A 251 character message was accepted.")
+	}
+
+	*maxLen = 0
+	if err := checkLength(strings.Repeat("a", 10000)); err != nil {
+		t.Errorf("A long message was rejected with no limit: %v", err)
 	}
 }
 
-func TestPubKey(t *testing.T) {
-	privKey, pubKey := keyContents()
-	signed, err := sign("Hello", pubKey, privKey)
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		length   int
+		expected string
+	}{
+		{"Hello", 3, "Hel"},
+		{"Hello", 5, "Hello"},
+		{"Hello", 10, "Hello"},
+		{"日本語です", 2, "日本"},
+		{"", 1, ""},
+	}
+
+	for _, test := range tests {
+		if got := truncateMessage(test.input, test.length); got != test.expected {
+			t.Errorf("Truncating %q to %d characters gave %q, expected %q.", test.input, test.length, got, test.expected)
+		}
+	}
+
+	privKey, _ := keyContents()
+	signed, err := sign("日本", privKey, signer.Options{Truncated: true})
 	if err != nil {
-		t.Errorf("Error signing message: %v", err)
+		t.Fatalf("Error signing message: %v", err)
+	}
+	if !strings.Contains(signed, `"truncated": true`) {
+		t.Errorf("The output does not note the truncation: %s", signed)
+	}
+	if _, err := signer.Verify([]byte(signed), nil, signer.Options{}); err != nil {
+		t.Errorf("The truncated message does not verify: %v", err)
+	}
+}
+
+func TestCheckEmpty(t *testing.T) {
+	defer func() { *allowEmpty = false }()
+
+	if err := checkEmpty(""); err == nil {
+		t.Error("An empty message was accepted.")
+	}
+	if err := checkEmpty(" "); err != nil {
+		t.Errorf("A message of a space was rejected: %v", err)
 	}
 
-	var out output
+	*allowEmpty = true
+	if err := checkEmpty(""); err != nil {
+		t.Errorf("An empty message was rejected with --allow-empty: %v", err)
+	}
+}
+
+func TestSignatureOnly(t *testing.T) {
+	privKey, _ := keyContents()
 
-	err = json.Unmarshal([]byte(signed), &out)
+	encSign, err := signatureOnly("Hello", privKey, signer.Options{})
 	if err != nil {
-		t.Errorf("Error unmarshaling json: %v", err)
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	decSign, err := base64.StdEncoding.DecodeString(encSign)
+	if err != nil {
+		t.Fatalf("The signature is not Base64 encoded: %v", err)
+	}
+
+	if !signer.VerifyMessage(&privKey.PublicKey, "Hello", signer.Options{}, decSign) {
+		t.Error("The signature alone does not verify.")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	privKey, _ := keyContents()
+
+	*compact = true
+	defer func() { *compact = false }()
+
+	opts := signer.Options{Deterministic: true, Nonce: "challenge-42"}
+
+	first, err := sign("Hello", privKey, opts)
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	second, err := sign("Hello", privKey, opts)
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	if first != second {
+		t.Error("Compact deterministic output differs between runs.")
+	}
+
+	// Compacting the indented output must give the same bytes.
+	*compact = false
+	pretty, err := sign("Hello", privKey, opts)
+	*compact = true
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(pretty)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != first {
+		t.Errorf("Compact output %q is not the indented output without whitespace.", first)
+	}
+
+	if !strings.HasPrefix(first, `{"message":"Hello","signature":"`) {
+		t.Errorf("Compact output %q does not start with the message and signature.", first)
+	}
+
+	valid, err := signer.Verify([]byte(first), nil, opts)
+	if err != nil || !valid {
+		t.Errorf("The compact output does not verify: %v", err)
+	}
+}
+
+func TestKeyfilePathDirectory(t *testing.T) {
+	dirPath := path.Join(t.TempDir(), "keypair.txt")
+	if err := os.Mkdir(dirPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	*keyfileFlag = dirPath
+	defer func() { *keyfileFlag = "" }()
+
+	_, err := keyfilePath()
+	if err == nil || !strings.Contains(err.Error(), "keyfile path "+dirPath+" is a directory") {
+		t.Errorf("A directory at the keyfile path gave %v, expected it to be named as a directory.", err)
+	}
+	if errorCode(err) != errCodeIO {
+		t.Errorf("A directory at the keyfile path has code %q, expected %q.", errorCode(err), errCodeIO)
+	}
+}
+
+func TestUseKeyContents(t *testing.T) {
+	privKey, publicKey := keyContents()
+	privBlock := keys[:strings.Index(keys, "-----BEGIN PUBLIC KEY-----")]
+
+	otherKey, err := signer.GenerateKey(signer.AlgoECDSA, "p256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := signer.PublicKeyPEM(otherKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFS = fstest.MapFS{
+		"keypair.txt":   {Data: []byte(keys)},
+		"empty.txt":     {Data: nil},
+		"partial.txt":   {Data: []byte(keys[:len(privBlock)/2])},
+		"private.txt":   {Data: []byte(privBlock)},
+		"mismatch.txt":  {Data: []byte(privBlock + otherPub)},
+		"badpublic.txt": {Data: []byte(privBlock + malformedPubKey)},
+	}
+	defer func() { keyFS = nil }()
+
+	loaded, loadedPub, err := useKey("keypair.txt")
+	if err != nil {
+		t.Fatalf("Error loading the key pair from memory: %v", err)
+	}
+	if !privKey.Equal(loaded) || loadedPub != strings.TrimPrefix(publicKey, "\n") {
+		t.Error("The key pair loaded from memory is not the one saved.")
+	}
+
+	// A keyfile whose public key was never written gets it back from the
+	// private key.
+	loaded, loadedPub, err = useKey("private.txt")
+	if err != nil {
+		t.Fatalf("Error loading a keyfile with only the private key: %v", err)
+	}
+	if !privKey.Equal(loaded) || loadedPub != strings.TrimPrefix(publicKey, "\n") {
+		t.Errorf("The public key derived from the private key is\n%s\nexpected\n%s", loadedPub, publicKey)
+	}
+
+	tests := map[string]string{
+		"empty.txt":     "is corrupt or not a PEM private key",
+		"partial.txt":   "is corrupt or not a PEM private key",
+		"mismatch.txt":  "has a public key that does not match the private key",
+		"badpublic.txt": "has a bad public key",
+		"missing.txt":   "file does not exist",
+	}
+
+	for name, expected := range tests {
+		_, _, err := useKey(name)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Loading %s gave %v, expected an error saying it %s.", name, err, expected)
+		}
+	}
+}
+
+func TestCreateSaveKeyRand(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x07}, ed25519.SeedSize)
+	expected := ed25519.NewKeyFromSeed(seed)
+	dir := t.TempDir()
+
+	privKey, _, fp, err := createSaveKey(path.Join(dir, "first.txt"), signer.AlgoEd25519, bytes.NewReader(seed))
+	if err != nil {
+		t.Fatalf("Error creating key pair: %v", err)
+	}
+	if !expected.Equal(privKey) {
+		t.Fatal("The key pair is not the one the fixed random source gives.")
+	}
+	if want, _ := signer.Fingerprint(expected.Public()); fp != want {
+		t.Errorf("The fingerprint is %s, expected %s.", fp, want)
+	}
+
+	signed, err := sign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out signer.Output
+	if err := json.Unmarshal([]byte(signed), &out); err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	expectedSig := base64.StdEncoding.EncodeToString(ed25519.Sign(expected, []byte(signer.Preimage("Hello", signer.Options{}))))
+	if out.Signature != expectedSig {
+		t.Errorf("Signature is %s, expected %s.", out.Signature, expectedSig)
+	}
+}
+
+func TestMarshalJSONError(t *testing.T) {
+	// A channel has no JSON encoding, compact or indented.
+	for _, compactJSON := range []bool{false, true} {
+		*compact = compactJSON
+		_, err := marshalJSON(struct{ C chan int }{})
+		if err == nil || !strings.HasPrefix(err.Error(), "marshaling JSON: ") {
+			t.Errorf("Marshaling a channel with compact %v returned %v.", compactJSON, err)
+		}
+	}
+	*compact = false
+}
+
+func TestMessageFromEnv(t *testing.T) {
+	t.Setenv("SIGNER_MESSAGE", "theAnswerIs42")
+	if message, err := messageFromEnv("SIGNER_MESSAGE"); err != nil || message != "theAnswerIs42" {
+		t.Errorf("Reading the message from the environment returned %q, %v.", message, err)
+	}
+
+	t.Setenv("SIGNER_MESSAGE", "")
+	if _, err := messageFromEnv("SIGNER_MESSAGE"); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("An empty variable returned %v.", err)
 	}
 
-	if out.PubKey != pubKey {
-		t.Error("Output public key does not match the input public key.")
+	if _, err := messageFromEnv("SIGNER_MESSAGE_UNSET"); err == nil || !strings.Contains(err.Error(), "is not set") {
+		t.Errorf("An unset variable returned %v.", err)
 	}
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The prefixes hashed in front of leaves and inner nodes of the Merkle tree, as
+// in RFC 6962, so a leaf can never be passed off as an inner node.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// The merkleDomain is the domain the root of a Merkle tree is signed for, so
+// the signature of a root is never that of a message, or of another root
+// signed some other way.
+const merkleDomain = "crypto-sign-challenge merkle root"
+
+// The merkleCommand function runs the "sign-merkle" subcommand with the
+// arguments that follow it on the command line.  It builds a Merkle tree over
+// the SHA256 digests of the given files, signs the root, and prints the root,
+// its signature, the public key and an inclusion proof for every file as JSON.
+func merkleCommand(args []string) {
+	flags := flag.NewFlagSet("sign-merkle", flag.ExitOnError)
+	flags.StringVar(keyfileFlag, "keyfile", "", "path of the key pair file")
+	flags.BoolVar(verbose, "verbose", *verbose, "log the key pair file and key used to standard error")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		usageError("Please provide the files to sign.")
+	}
+
+	// The files are hashed as they are read, so they can be any size.
+	digests := make([][]byte, flags.NArg())
+	for i, name := range flags.Args() {
+		digest, err := signer.HashFile("sha256", name)
+		checkError(err)
+
+		digests[i] = digest
+	}
+
+	filePath, err := keyfilePath()
+	checkError(err)
+
+	privKey, pubKey, err := loadOrCreateKey(filePath, "")
+	checkError(err)
+
+	root, proofs, err := merkleTree(digests)
+	checkError(err)
+
+	sign, err := signMerkleRoot(privKey, root)
+	checkError(withCode(errCodeSign, err))
+
+	var out merkleOutput
+	out.Root = hex.EncodeToString(root)
+	out.Signature = base64.StdEncoding.EncodeToString(sign)
+	out.PubKey = pubKey
+	for i, name := range flags.Args() {
+		out.Leaves = append(out.Leaves, merkleLeaf{
+			File:   name,
+			Digest: hex.EncodeToString(digests[i]),
+			Proof:  proofs[i],
+		})
+	}
+
+	outJSON, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		checkError(fmt.Errorf("marshaling JSON: %w", err))
+	}
+
+	fmt.Println(string(outJSON))
+}
+
+// The signMerkleRoot function takes in the private key and the root of a
+// Merkle tree, and returns the signature of the root, made over its preimage
+// for merkleDomain, or an error if there is one.
+func signMerkleRoot(privKey crypto.Signer, root []byte) ([]byte, error) {
+	opts := signer.Options{Domain: merkleDomain}
+	return signer.SignMessage(privKey, signer.Preimage(string(root), opts), opts)
+}
+
+// The verifyMerkle function takes in the path of the JSON written by
+// sign-merkle, the path of one of the files it signed and a trusted public
+// key, or nil to use the one in the JSON.  It returns the signer.VerifyResult,
+// valid if the signature of the root verifies and the proof of the file leads
+// to the root, or an error if a file can not be read or the JSON parsed.  A
+// file that is not one of the leaves, or whose proof is wrong, is invalid, with
+// the reason in the result and printed to standard error.
+func verifyMerkle(proofPath, filePath string, trusted crypto.PublicKey) (signer.VerifyResult, error) {
+	contents, err := os.ReadFile(proofPath)
+	if err != nil {
+		return signer.VerifyResult{}, err
+	}
+
+	var out merkleOutput
+	if err := json.Unmarshal(contents, &out); err != nil {
+		return signer.VerifyResult{}, withCode(errCodeParse, fmt.Errorf("parsing %s: %w", proofPath, err))
+	}
+
+	root, err := hex.DecodeString(out.Root)
+	if err != nil {
+		return signer.VerifyResult{}, withCode(errCodeParse, fmt.Errorf("the root is not hex: %w", err))
+	}
+	sign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return signer.VerifyResult{}, withCode(errCodeParse, fmt.Errorf("the signature is not Base64: %w", err))
+	}
+
+	// The public key in the JSON comes from whoever wrote it, so a key the
+	// user already trusts takes its place when one is given.
+	pubKey := trusted
+	if pubKey == nil {
+		pubKey, err = signer.ParsePublicKey([]byte(out.PubKey))
+		if err != nil {
+			return signer.VerifyResult{}, err
+		}
+	}
+
+	digest, err := signer.HashFile("sha256", filePath)
+	if err != nil {
+		return signer.VerifyResult{}, err
+	}
+
+	valid := signer.VerifyMessage(pubKey, string(root), signer.Options{Domain: merkleDomain}, sign)
+	result := signer.NewVerifyResult(valid, pubKey)
+	if !valid {
+		return result, nil
+	}
+
+	result.Valid = false
+	result.Reason = "the file is not one of the leaves"
+	for _, leaf := range out.Leaves {
+		if leaf.Digest == hex.EncodeToString(digest) {
+			result.Valid = verifyInclusion(digest, leaf.Proof, root)
+			result.Reason = "the proof of the file does not lead to the signed root"
+			break
+		}
+	}
+
+	if result.Valid {
+		result.Reason = ""
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filePath, result.Reason)
+	}
+	return result, nil
+}
+
+// The merkleTree function takes in the digests of the leaves, in order, and
+// returns the root of the Merkle tree over them and the inclusion proof of each
+// leaf, or an error if there are no leaves.  When a level has an odd number of
+// nodes the last one moves up to the next level unchanged.
+func merkleTree(digests [][]byte) ([]byte, [][]proofStep, error) {
+	if len(digests) == 0 {
+		return nil, nil, errors.New("a Merkle tree needs at least one leaf")
+	}
+
+	level := make([][]byte, len(digests))
+	for i, digest := range digests {
+		level[i] = merkleLeafHash(digest)
+	}
+
+	// positions holds where each leaf's ancestor sits in the current level.
+	proofs := make([][]proofStep, len(digests))
+	positions := make([]int, len(digests))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	for len(level) > 1 {
+		for i, p := range positions {
+			if p%2 == 1 {
+				proofs[i] = append(proofs[i], proofStep{hex.EncodeToString(level[p-1]), "left"})
+			} else if p+1 < len(level) {
+				proofs[i] = append(proofs[i], proofStep{hex.EncodeToString(level[p+1]), "right"})
+			}
+			positions[i] = p / 2
+		}
+
+		var next [][]byte
+		for j := 0; j < len(level); j += 2 {
+			if j+1 < len(level) {
+				next = append(next, merkleNodeHash(level[j], level[j+1]))
+			} else {
+				next = append(next, level[j])
+			}
+		}
+		level = next
+	}
+
+	return level[0], proofs, nil
+}
+
+// The verifyInclusion function takes in the digest of a leaf, its inclusion
+// proof and the Merkle root.  It returns true only if the proof leads from the
+// leaf to the root.
+func verifyInclusion(digest []byte, proof []proofStep, root []byte) bool {
+	hash := merkleLeafHash(digest)
+
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+
+		switch step.Side {
+		case "left":
+			hash = merkleNodeHash(sibling, hash)
+		case "right":
+			hash = merkleNodeHash(hash, sibling)
+		default:
+			return false
+		}
+	}
+
+	return bytes.Equal(hash, root)
+}
+
+// The merkleLeafHash function returns the hash of a leaf holding the digest.
+func merkleLeafHash(digest []byte) []byte {
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, digest...))
+	return sum[:]
+}
+
+// The merkleNodeHash function returns the hash of an inner node with the given
+// left and right children.
+func merkleNodeHash(left, right []byte) []byte {
+	data := append([]byte{merkleNodePrefix}, left...)
+	sum := sha256.Sum256(append(data, right...))
+	return sum[:]
+}
+
+// The merkleOutput struct holds the JSON printed by the sign-merkle command.
+// The root is hex encoded and the signature is the Base64 encoded signature of
+// the root.
+type merkleOutput struct {
+	Root      string       `json:"root"`
+	Signature string       `json:"signature"`
+	PubKey    string       `json:"pubkey"`
+	Leaves    []merkleLeaf `json:"leaves"`
+}
+
+// The merkleLeaf struct holds a file name, the hex SHA256 digest of the file,
+// and the proof that the digest is included under the signed root.
+type merkleLeaf struct {
+	File   string      `json:"file"`
+	Digest string      `json:"digest"`
+	Proof  []proofStep `json:"proof"`
+}
+
+// The proofStep struct holds the hex hash of a sibling on the path from a leaf
+// to the root and whether the sibling is on the "left" or the "right".
+type proofStep struct {
+	Hash string `json:"hash"`
+	Side string `json:"side"`
+}
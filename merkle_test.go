@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func merkleDigests(n int) [][]byte {
+	digests := make([][]byte, n)
+	for i := range digests {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("file %d", i)))
+		digests[i] = sum[:]
+	}
+	return digests
+}
+
+func TestMerkleInclusion(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		digests := merkleDigests(n)
+
+		root, proofs, err := merkleTree(digests)
+		if err != nil {
+			t.Fatalf("Error building tree of %d leaves: %v", n, err)
+		}
+
+		for i, digest := range digests {
+			if !verifyInclusion(digest, proofs[i], root) {
+				t.Errorf("Leaf %d of %d is not included under the root.", i, n)
+			}
+		}
+
+		if n > 1 && verifyInclusion(digests[0], proofs[1], root) {
+			t.Errorf("Leaf 0 of %d verifies with the proof of leaf 1.", n)
+		}
+	}
+}
+
+func TestMerkleSignedRoot(t *testing.T) {
+	privKey, _ := keyContents()
+	digests := merkleDigests(5)
+
+	root, proofs, err := merkleTree(digests)
+	if err != nil {
+		t.Fatalf("Error building tree: %v", err)
+	}
+
+	sign, err := signMerkleRoot(privKey, root)
+	if err != nil {
+		t.Fatalf("Error signing root: %v", err)
+	}
+
+	// A verifier holding only file 3, its proof, the root and the signature.
+	if !verifyInclusion(digests[3], proofs[3], root) {
+		t.Error("Leaf 3 is not included under the root.")
+	}
+	if !signer.VerifyMessage(&privKey.PublicKey, string(root), signer.Options{Domain: merkleDomain}, sign) {
+		t.Error("The root signature is not valid.")
+	}
+
+	// The root is signed for its domain, so the signature is neither one of
+	// the bare digest nor one of the root as a message.
+	if signer.VerifyDigest(&privKey.PublicKey, root, sign) {
+		t.Error("The root signature verifies as a signature of the bare digest.")
+	}
+	if signer.VerifyMessage(&privKey.PublicKey, string(root), signer.Options{}, sign) {
+		t.Error("The root signature verifies as a signature of a message.")
+	}
+
+	other := sha256.Sum256([]byte("not in the tree"))
+	if verifyInclusion(other[:], proofs[3], root) {
+		t.Error("A digest that is not in the tree verifies.")
+	}
+}
+
+func TestMerkleEmpty(t *testing.T) {
+	_, _, err := merkleTree(nil)
+	if err == nil {
+		t.Error("A tree with no leaves did not return an error.")
+	}
+}
+
+func TestVerifyMerkle(t *testing.T) {
+	privKey, pubKey := keyContents()
+	dir := t.TempDir()
+
+	// The files hold what merkleDigests hashes.
+	digests := merkleDigests(3)
+	var names []string
+	for i := range digests {
+		name := path.Join(dir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("file %d", i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	root, proofs, err := merkleTree(digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign, err := signMerkleRoot(privKey, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := merkleOutput{
+		Root:      hex.EncodeToString(root),
+		Signature: base64.StdEncoding.EncodeToString(sign),
+		PubKey:    pubKey,
+	}
+	for i, name := range names {
+		out.Leaves = append(out.Leaves, merkleLeaf{File: name, Digest: hex.EncodeToString(digests[i]), Proof: proofs[i]})
+	}
+	writeProof := func(out merkleOutput) string {
+		contents, err := json.Marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofPath := path.Join(dir, "merkle.json")
+		if err := os.WriteFile(proofPath, contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return proofPath
+	}
+	proofPath := writeProof(out)
+
+	for _, name := range names {
+		result, err := verifyMerkle(proofPath, name, nil)
+		if err != nil || !result.Valid {
+			t.Errorf("%s is not under the signed root: %v", name, err)
+		}
+	}
+
+	// A file that is not in the tree.
+	other := path.Join(dir, "other.txt")
+	if err := os.WriteFile(other, []byte("not in the tree"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := verifyMerkle(proofPath, other, nil); err != nil || result.Valid || result.Reason == "" {
+		t.Errorf("A file that is not in the tree verifies: %+v, %v", result, err)
+	}
+
+	// A trusted key that did not sign the root.
+	otherKey, err := signer.GenerateKey(signer.AlgoECDSA, "p256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := verifyMerkle(proofPath, names[0], otherKey.Public()); err != nil || result.Valid {
+		t.Errorf("The root verifies under a key that did not sign it: %v", err)
+	}
+
+	// A wrong proof.
+	wrong := out
+	wrong.Leaves = []merkleLeaf{{File: names[0], Digest: out.Leaves[0].Digest, Proof: proofs[1]}}
+	if result, err := verifyMerkle(writeProof(wrong), names[0], nil); err != nil || result.Valid {
+		t.Errorf("A file verifies with the proof of another: %v", err)
+	}
+}
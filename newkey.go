@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The newKey flag replaces the key pair with a new one before signing, and the
+// yes flag skips the question asked before the old one is thrown away.
+var (
+	newKey = flag.Bool("new", false, "replace the key pair with a new one before signing, asking first unless --yes is given")
+	yes    = flag.Bool("yes", false, "with --new, replace the key pair without asking")
+)
+
+// The newKeyPair function takes in the path of the key pair file and creates a
+// new key pair in it with createSaveKey, in place of the one already there.
+// Unless --yes is given, it first asks on the terminal whether the existing key
+// pair may be replaced.  It returns the new private key and its public key in a
+// PEM formatted string, or an error if the key pair was not replaced.
+func newKeyPair(filePath string) (crypto.Signer, string, error) {
+	exists, err := keyOptions(*algo).HasKeyPair(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if exists && !*yes {
+		if !stdinIsTerminal() {
+			return nil, "", fmt.Errorf("a key pair exists at %s, use --yes to replace it without asking", filePath)
+		}
+
+		question := fmt.Sprintf("Replace the key pair at %s with a new one? The old private key is lost.", filePath)
+		ok, err := confirm(os.Stderr, os.Stdin, question)
+		if err != nil {
+			return nil, "", err
+		}
+		if !ok {
+			return nil, "", errors.New("the key pair was not replaced")
+		}
+	}
+
+	verbosef("Creating a new key pair at %s", filePath)
+	privKey, pubKey, fp, err := createSaveKey(filePath, *algo, rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logNewIdentity(fp)
+	return privKey, pubKey, nil
+}
+
+// The confirm function takes in a writer to ask on, a reader to read the
+// answer from and a question.  It writes the question followed by "[y/N]" and
+// returns true only if the answer is "y" or "yes", in any case, or an error if
+// no answer can be read.
+func confirm(w io.Writer, r io.Reader, question string) (bool, error) {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+
+	answer, err := readLine(bufio.NewReader(r))
+	if err != nil {
+		return false, fmt.Errorf("could not read the answer: %v", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
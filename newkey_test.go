@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := map[string]bool{
+		"y\n":       true,
+		"YES\r\n":   true,
+		" yes \n":   true,
+		"n\n":       false,
+		"\n":        false,
+		"yep\n":     false,
+		"y":         true,
+		"no thanks": false,
+	}
+
+	for answer, expected := range tests {
+		var w bytes.Buffer
+		got, err := confirm(&w, strings.NewReader(answer), "Replace it?")
+		if err != nil {
+			t.Errorf("Error reading answer %q: %v", answer, err)
+		}
+		if got != expected {
+			t.Errorf("Answer %q gave %v, expected %v.", answer, got, expected)
+		}
+		if w.String() != "Replace it? [y/N] " {
+			t.Errorf("The question was written as %q.", w.String())
+		}
+	}
+
+	if _, err := confirm(&bytes.Buffer{}, strings.NewReader(""), "Replace it?"); err == nil {
+		t.Error("No answer at all did not return an error.")
+	}
+}
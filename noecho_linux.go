@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// The ioctl requests that get and set the attributes of a terminal.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
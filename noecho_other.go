@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "os"
+
+// The hideInput function can not turn off the echo of a terminal on this
+// system, so it leaves the terminal as it is and returns a function that does
+// nothing.  Set the passphrase in passphraseEnv to keep it off the screen.
+func hideInput(f *os.File) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The hideInput function takes in a terminal and turns off the echo of what is
+// typed into it, so a passphrase is not shown on the screen.  Lines are still
+// read whole and Ctrl-C still interrupts.  It returns a function that puts the
+// terminal back as it was, or an error if the file is not a terminal.
+func hideInput(f *os.File) (func(), error) {
+	fd := f.Fd()
+
+	var old syscall.Termios
+	if err := termios(fd, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+
+	hidden := old
+	hidden.Lflag &^= syscall.ECHO
+	hidden.Lflag |= syscall.ICANON | syscall.ISIG
+	hidden.Iflag |= syscall.ICRNL
+	if err := termios(fd, ioctlSetTermios, &hidden); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		termios(fd, ioctlSetTermios, &old)
+	}, nil
+}
+
+// The termios function takes in the file descriptor of a terminal, the ioctl
+// request that gets or sets its attributes and the attributes, and makes the
+// request.  It returns an error if the request fails.
+func termios(fd, request uintptr, attrs *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(attrs)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
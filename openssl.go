@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"fmt"
+)
+
+// The file names used in the emitted OpenSSL command.  The recipient saves the
+// parts of the output under these names before running it.
+const (
+	opensslPubFile = "pub.pem"
+	opensslSigFile = "sig.der"
+	opensslMsgFile = "preimage.bin"
+)
+
+// The opensslVerifyCommand function takes in the name of the hash used for the
+// signature, as OpenSSL spells it (for example "sha256"), and returns the
+// openssl command that verifies the signature once the public key, the DER
+// signature and the preimage are saved under the file names above.
+func opensslVerifyCommand(hash string) string {
+	return fmt.Sprintf("openssl dgst -%s -verify %s -signature %s %s",
+		hash, opensslPubFile, opensslSigFile, opensslMsgFile)
+}
+
+// The opensslEd25519VerifyCommand function returns the openssl command that
+// verifies an Ed25519 signature once the public key, the raw signature and the
+// preimage are saved under the file names above.  Ed25519 signs the preimage
+// itself, so there is no digest option.
+func opensslEd25519VerifyCommand() string {
+	return fmt.Sprintf("openssl pkeyutl -verify -pubin -inkey %s -rawin -in %s -sigfile %s",
+		opensslPubFile, opensslMsgFile, opensslSigFile)
+}
+
+// The opensslVerifyHint function takes in the public key and the name of the
+// hash used for the signature and returns instructions, ending in the openssl
+// command, for a recipient who wants to verify the signature with OpenSSL.
+// What is signed is the preimage of the message, not the message itself, so
+// the instructions are followed by the preimage as writePreimage prints it.
+func opensslVerifyHint(pubKey crypto.PublicKey, hash string) string {
+	if _, ok := pubKey.(ed25519.PublicKey); ok {
+		return fmt.Sprintf("To verify with OpenSSL save the public key to %s, the Base64 decoded\n"+
+			"signature to %s and the hex decoded preimage below to %s, then run:\n"+
+			"    %s\n", opensslPubFile, opensslSigFile, opensslMsgFile, opensslEd25519VerifyCommand())
+	}
+
+	// The signature is ASN.1 DER once it is Base64 decoded, which is the format
+	// "openssl dgst -verify" expects, and the public key is a PKIX "PUBLIC KEY"
+	// PEM block which OpenSSL reads as is.
+	return fmt.Sprintf("To verify with OpenSSL save the public key to %s, the Base64 decoded\n"+
+		"signature to %s and the hex decoded preimage below to %s, then run:\n"+
+		"    %s\n", opensslPubFile, opensslSigFile, opensslMsgFile, opensslVerifyCommand(hash))
+}
@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+func TestOpensslVerifyCommand(t *testing.T) {
+	expected := "openssl dgst -sha256 -verify pub.pem -signature sig.der preimage.bin"
+
+	if cmd := opensslVerifyCommand("sha256"); cmd != expected {
+		t.Errorf("Command is %q, expected %q.", cmd, expected)
+	}
+}
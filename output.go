@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The outputTarget struct is where the signed message is written: standard
+// out, a regular file that is replaced atomically, or a file that is not a
+// regular file, such as a named pipe or an inherited descriptor like
+// /dev/fd/3, which is opened once and written in place.
+type outputTarget struct {
+	// path is the regular file to replace, empty if file is set.
+	path string
+
+	// file is standard out or the opened file that is not a regular file.
+	file *os.File
+}
+
+// The openOutput function takes in the path given to --output and returns the
+// target to write the output to, or an error if it can not be written: the
+// path is a directory, its directory does not exist, or it is not a regular
+// file and can not be opened for writing.  It is called before signing so a
+// bad --output is found before any work is done.
+func openOutput(filePath string) (*outputTarget, error) {
+	if filePath == "" || filePath == "-" {
+		return &outputTarget{file: os.Stdout}, nil
+	}
+
+	info, err := os.Stat(filePath)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("output %s is a directory", filePath)
+	case err == nil && !info.Mode().IsRegular():
+		// A pipe or descriptor can not be renamed over, and may already be
+		// holding a reader, so it is written in place.
+		file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &outputTarget{file: file}, nil
+	case err == nil:
+		return &outputTarget{path: filePath}, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	dir := filepath.Dir(filePath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("output %s can not be written, %s is not a directory", filePath, dir)
+	}
+	return &outputTarget{path: filePath}, nil
+}
+
+// The write method takes in the signed message and writes it, followed by a
+// newline unless --no-newline is given, to the target.  A regular file is
+// replaced only once it is written completely, with Owner read/write
+// permission.  It returns an error if any write, or closing a file that is not
+// a regular file, fails.
+func (t *outputTarget) write(output string) error {
+	// The output ends with a newline unless --no-newline is given.
+	if !*noNewline {
+		output += "\n"
+	}
+
+	if t.file == nil {
+		return signer.WriteFileAtomic(t.path, func(w io.Writer) error {
+			return signer.WriteAll(w, []byte(output))
+		})
+	}
+
+	err := signer.WriteAll(t.file, []byte(output))
+	if t.file != os.Stdout {
+		if closeErr := t.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// The writeOutput function takes in the path given to --output and the signed
+// message, and writes the message to it as openOutput and the write method do,
+// returning an error if there is one.
+func writeOutput(filePath, output string) error {
+	target, err := openOutput(filePath)
+	if err != nil {
+		return err
+	}
+	return target.write(output)
+}
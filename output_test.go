@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteOutputPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The write end is reached through its descriptor, as a parent process
+	// would hand it over as --output /dev/fd/3.
+	fdPath := fmt.Sprintf("/dev/fd/%d", w.Fd())
+	if _, err := os.Stat(fdPath); err != nil {
+		w.Close()
+		t.Skipf("No %s on this system: %v", fdPath, err)
+	}
+
+	signed := `{"message": "Hello", "signature": "MEUCIQ=="}`
+	done := make(chan []byte)
+	go func() {
+		contents, _ := io.ReadAll(r)
+		done <- contents
+	}()
+
+	err = writeOutput(fdPath, signed)
+	w.Close()
+	if err != nil {
+		t.Fatalf("Error writing to the pipe: %v", err)
+	}
+
+	if contents := <-done; string(contents) != signed+"\n" {
+		t.Errorf("The pipe carried %q, expected %q.", contents, signed+"\n")
+	}
+}
+
+func TestOpenOutputErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := openOutput(dir); err == nil {
+		t.Error("A directory was accepted as the output.")
+	}
+	if _, err := openOutput(path.Join(dir, "missing", "signed.json")); err == nil {
+		t.Error("An output in a missing directory was accepted.")
+	}
+	if _, err := openOutput(path.Join(dir, "signed.json")); err != nil {
+		t.Errorf("A new output file was refused: %v", err)
+	}
+}
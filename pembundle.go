@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The type of the PEM block holding the metadata in a PEM bundle.
+const metadataBlockType = "SIGNER METADATA"
+
+// The bundleMetadata struct holds the JSON in the SIGNER METADATA block of a
+// PEM bundle: what a verifier needs to know, besides the public key, to check
+// messages signed with it.
+type bundleMetadata struct {
+	// Curve is the curve of the key, such as "P-521" or "Ed25519".
+	Curve string `json:"curve"`
+
+	// KeyID is the key ID the JSON of each signed message carries as "kid".
+	KeyID string `json:"kid"`
+
+	// Hash is the hash ECDSA signatures are made with, left out for Ed25519
+	// keys, which hash the message themselves.
+	Hash string `json:"hash,omitempty"`
+
+	// CreatedAt is the RFC 3339 time the bundle was made.
+	CreatedAt string `json:"created_at"`
+}
+
+// The pemBundle function takes in a public key, the name of the hash its
+// signatures are made with and the time, and returns a PEM bundle for a
+// verifier: the "PUBLIC KEY" block followed by a SIGNER METADATA block holding
+// the JSON of a bundleMetadata, or an error if there is one.
+func pemBundle(pubKey crypto.PublicKey, hash string, now time.Time) (string, error) {
+	pubPEM, err := signer.PublicKeyPEM(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	kid, err := signer.KeyID(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	meta := bundleMetadata{
+		Curve:     signer.KeyCurve(pubKey),
+		KeyID:     kid,
+		CreatedAt: now.UTC().Format(time.RFC3339),
+	}
+	if signer.KeyAlgorithm(pubKey) == signer.AlgoECDSA {
+		meta.Hash = signer.HashName(hash)
+	}
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	return pubPEM + string(pem.EncodeToMemory(&pem.Block{Type: metadataBlockType, Bytes: metaJSON})), nil
+}
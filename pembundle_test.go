@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestPEMBundle(t *testing.T) {
+	privKey, _ := keyContents()
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	bundle, err := pemBundle(privKey.Public(), "sha512", now)
+	if err != nil {
+		t.Fatalf("Error making the bundle: %v", err)
+	}
+
+	// The public key comes first, so anything reading one PEM public key, such
+	// as verify --verify-against, can read the bundle.
+	pubKey, err := signer.ParsePublicKey([]byte(bundle))
+	if err != nil || !signer.SameKey(pubKey, privKey.Public()) {
+		t.Errorf("The bundle does not start with the public key: %v", err)
+	}
+
+	_, rest := pem.Decode([]byte(bundle))
+	block, rest := pem.Decode(rest)
+	if block == nil || block.Type != metadataBlockType || len(rest) != 0 {
+		t.Fatalf("The bundle has no %s block after the public key.", metadataBlockType)
+	}
+
+	var meta bundleMetadata
+	if err := json.Unmarshal(block.Bytes, &meta); err != nil {
+		t.Fatalf("Error unmarshaling the metadata: %v", err)
+	}
+
+	kid, _ := signer.KeyID(privKey.Public())
+	expected := bundleMetadata{Curve: "P-521", KeyID: kid, Hash: "sha512", CreatedAt: "2024-01-31T12:00:00Z"}
+	if meta != expected {
+		t.Errorf("The metadata is %+v, expected %+v.", meta, expected)
+	}
+
+	// Ed25519 keys hash the message themselves.
+	edKey, err := signer.GenerateKey(signer.AlgoEd25519, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err = pemBundle(edKey.Public(), "sha256", now)
+	if err != nil {
+		t.Fatalf("Error making the Ed25519 bundle: %v", err)
+	}
+	_, rest = pem.Decode([]byte(bundle))
+	block, _ = pem.Decode(rest)
+	meta = bundleMetadata{}
+	if err := json.Unmarshal(block.Bytes, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Curve != "Ed25519" || meta.Hash != "" {
+		t.Errorf("The Ed25519 metadata is %+v, expected the Ed25519 curve and no hash.", meta)
+	}
+}
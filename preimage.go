@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The showPreimage flag prints the bytes that are hashed and signed, hex
+// encoded, so a verifier written without this tool can check it builds the
+// same ones.
+var showPreimage = flag.Bool("show-preimage", false, "print the hex of the bytes that are hashed and signed to standard error")
+
+// The writePreimage function takes in a writer, the message and the
+// signer.Options it is signed with, and writes the preimage signer.Sign hashes
+// and signs for it, hex encoded, on a line of its own.  It returns an error if
+// the message can not be decoded or the writer fails.
+func writePreimage(w io.Writer, input string, opts signer.Options) error {
+	preimage, err := signer.SignedBytes(input, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "preimage: %s\n", hex.EncodeToString(preimage))
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestWritePreimage(t *testing.T) {
+	opts := signer.Options{Nonce: "n", InputEncoding: signer.InputHex}
+
+	var w bytes.Buffer
+	if err := writePreimage(&w, "6869", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The format tag, the nonce tag, the length of the nonce, the nonce, the
+	// message tag, the length of the message and the decoded message, "hi".
+	want := "preimage: 63727970746f2d7369676e2d6368616c6c656e676520707265696d616765207631" + "00" +
+		"63727970746f2d7369676e2d6368616c6c656e6765206e6f6e63652076310000000001" + "6e" +
+		"63727970746f2d7369676e2d6368616c6c656e6765206d6573736167652076310000000002" + "6869\n"
+	if w.String() != want {
+		t.Fatalf("The preimage is %q, expected %q.", w.String(), want)
+	}
+
+	// The preimage is what the signature is over.
+	privKey, _ := keyContents()
+	out, err := signer.Sign("6869", privKey, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preimage, err := hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(w.String(), "preimage: ")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(preimage)
+	if !signer.VerifyDigest(&privKey.PublicKey, digest[:], sign) {
+		t.Error("The signature is not over the preimage shown.")
+	}
+
+	if err := writePreimage(&w, "not hex", opts); err == nil {
+		t.Error("A message that can not be decoded has a preimage.")
+	}
+}
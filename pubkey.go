@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The pubkeyCommand function runs the "pubkey" subcommand with the arguments
+// that follow it on the command line.  It prints the PEM public key, or with
+// --fingerprint its fingerprint and with --out-der its Base64 DER, creating
+// the key pair first if there is none.
+func pubkeyCommand(args []string) {
+	flags := flag.NewFlagSet("pubkey", flag.ExitOnError)
+	flags.StringVar(keyfileFlag, "keyfile", "", "path of the key pair file")
+	flags.StringVar(identity, "identity", "", "name of the key pair to use when the file holds several")
+	flags.StringVar(algo, "algo", "", `key algorithm if one is created: "ecdsa" (the default) or "ed25519"`)
+	flags.StringVar(curve, "curve", "", `curve if an ECDSA key is created: "p256", "p384" or "p521" (the default)`)
+	flags.BoolVar(pkcs8, "pkcs8", *pkcs8, "save an ECDSA private key in PKCS#8 form if one is created")
+	flags.Var(&keyfileMode, "keyfile-mode", keyfileModeUsage)
+	flags.BoolVar(allowInsecurePerms, "allow-insecure-perms", *allowInsecurePerms, "allow a --keyfile-mode that lets every user read or write the key pair file")
+	flags.BoolVar(strictPerms, "strict-perms", *strictPerms, "refuse a key pair file with looser permissions than --keyfile-mode instead of warning")
+	flags.BoolVar(encryptKey, "encrypt", *encryptKey, "encrypt the private key with a passphrase if one is created")
+	printFingerprint := flags.Bool("fingerprint", false, "print the hex SHA256 fingerprint of the public key instead")
+	flags.BoolVar(outDER, "out-der", false, "print the public key as Base64 DER instead of PEM")
+	flags.BoolVar(verbose, "verbose", *verbose, "log the key pair file and key used to standard error")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		usageError("The pubkey command does not take any arguments.")
+	}
+	if *printFingerprint && *outDER {
+		usageError("Please provide either --fingerprint or --out-der, not both.")
+	}
+
+	filePath, err := keyfilePath()
+	checkError(err)
+
+	privKey, pubKey, err := loadOrCreateKey(filePath, *algo)
+	checkError(err)
+
+	if *printFingerprint {
+		fp, err := signer.Fingerprint(privKey.Public())
+		checkError(err)
+
+		fmt.Println(fp)
+		return
+	}
+
+	if *outDER {
+		der, err := signer.PublicKeyDER(privKey.Public())
+		checkError(err)
+
+		fmt.Println(der)
+		return
+	}
+
+	fmt.Print(pubKey)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The rotateCommand function runs the "rotate" subcommand with the arguments
+// that follow it on the command line.  It moves the current key pair file
+// aside, dated, creates a new key pair in its place and prints the
+// fingerprints of the old and the new key.
+func rotateCommand(args []string) {
+	flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+	flags.StringVar(keyfileFlag, "keyfile", "", "path of the key pair file")
+	flags.StringVar(algo, "algo", "", `key algorithm of the new key: "ecdsa" (the default) or "ed25519"`)
+	flags.StringVar(curve, "curve", "", `curve for a new ECDSA key: "p256", "p384" or "p521" (the default)`)
+	flags.BoolVar(pkcs8, "pkcs8", *pkcs8, "save a new ECDSA private key in PKCS#8 form instead of SEC1")
+	flags.Var(&keyfileMode, "keyfile-mode", keyfileModeUsage)
+	flags.BoolVar(allowInsecurePerms, "allow-insecure-perms", *allowInsecurePerms, "allow a --keyfile-mode that lets every user read or write the key pair file")
+	flags.BoolVar(strictPerms, "strict-perms", *strictPerms, "refuse a key pair file with looser permissions than --keyfile-mode instead of warning")
+	flags.BoolVar(encryptKey, "encrypt", *encryptKey, "encrypt the new private key with a passphrase")
+	noArchive := flags.Bool("no-archive", false, "delete the old key pair instead of keeping it")
+	flags.BoolVar(verbose, "verbose", *verbose, "log the key pair file and key used to standard error")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		usageError("The rotate command does not take any arguments.")
+	}
+
+	filePath, err := keyfilePath()
+	checkError(err)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		usageError("There is no key pair at %s to rotate, use keygen to create one.", filePath)
+	}
+
+	identities, err := keyOptions(*algo).ListIdentities(filePath)
+	checkError(err)
+	if err := checkRotatable(filePath, identities); err != nil {
+		usageError("%v.", err)
+	}
+
+	oldFP, newFP, archived, err := rotateKey(filePath, *algo, !*noArchive, time.Now())
+	checkError(err)
+
+	if archived != "" {
+		fmt.Printf("Old fingerprint: %s (archived at %s)\n", oldFP, archived)
+	} else {
+		fmt.Printf("Old fingerprint: %s (deleted)\n", oldFP)
+	}
+	fmt.Printf("New fingerprint: %s\n", newFP)
+}
+
+// The checkRotatable function takes in the file path of a key pair file and
+// the key pairs it holds, and returns an error unless it holds only the default
+// key pair.  The whole file is archived, which would take any other key pairs
+// with it, and the new key pair is the default one, which would silently give
+// a lone named key pair a new name.
+func checkRotatable(filePath string, identities []signer.Identity) error {
+	if len(identities) > 1 {
+		return fmt.Errorf("the key pair file %s holds %d key pairs, rotate only works on a file holding one; use keygen --force --identity NAME to replace one", filePath, len(identities))
+	}
+	if len(identities) == 1 && identities[0].Name != "" {
+		return fmt.Errorf("the key pair file %s holds the key pair %q, rotate only works on the default key pair; use keygen --force --identity %s to replace it", filePath, identities[0].Name, identities[0].Name)
+	}
+	return nil
+}
+
+// The rotateKey function takes in the file path of the key pair file, the key
+// algorithm of the new key, whether to keep the old key pair and the time of
+// the rotation.  It renames the key pair file to its archive path, creates and
+// saves a new key pair at the file path, and deletes the old one if it is not
+// kept.  It returns the fingerprints of the old and new keys and the archive
+// path, empty if the old key pair was deleted, or an error if there is one.  If
+// the new key pair can not be created, the old one is put back.
+func rotateKey(filePath, algo string, archive bool, now time.Time) (string, string, string, error) {
+	// The old key is loaded first, so a keyfile that can not be read is never
+	// moved aside.
+	oldKey, _, err := useKey(filePath)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	oldFP, err := signer.Fingerprint(oldKey.Public())
+	if err != nil {
+		return "", "", "", err
+	}
+
+	archived, err := archivePath(filePath, now)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	verbosef("Archiving the key pair at %s", archived)
+	if err := os.Rename(filePath, archived); err != nil {
+		return "", "", "", err
+	}
+
+	_, _, newFP, err := createSaveKey(filePath, algo, rand.Reader)
+	if err != nil {
+		if restoreErr := os.Rename(archived, filePath); restoreErr != nil {
+			return "", "", "", fmt.Errorf("%v, and the old key pair is left at %s", err, archived)
+		}
+		return "", "", "", err
+	}
+
+	if !archive {
+		if err := os.Remove(archived); err != nil {
+			return "", "", "", err
+		}
+		archived = ""
+	}
+
+	return oldFP, newFP, archived, nil
+}
+
+// The archivePath function takes in the file path of the key pair file and the
+// time of the rotation, and returns the path the file is archived at: the date
+// put before the extension, for example keypair.20240131.txt.  If that file
+// exists already a counter is added, keypair.20240131.2.txt and so on.  It
+// returns an error if no free name is found.
+func archivePath(filePath string, now time.Time) (string, error) {
+	ext := filepath.Ext(filePath)
+	base := strings.TrimSuffix(filePath, ext) + "." + now.Format("20060102")
+
+	for n := 1; n <= 100; n++ {
+		archived := base + ext
+		if n > 1 {
+			archived = base + "." + strconv.Itoa(n) + ext
+		}
+
+		_, err := os.Stat(archived)
+		if os.IsNotExist(err) {
+			return archived, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", errors.New("too many archived key pairs for today, please move some away")
+}
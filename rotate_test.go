@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestRotateKey(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, keyfile)
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	oldKey, _, _, err := createSaveKey(filePath, signer.AlgoECDSA, rand.Reader)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	oldFP, _ := signer.Fingerprint(oldKey.Public())
+
+	gotOld, gotNew, archived, err := rotateKey(filePath, "", true, now)
+	if err != nil {
+		t.Fatalf("Error rotating key: %v", err)
+	}
+
+	if gotOld != oldFP || gotNew == oldFP {
+		t.Errorf("Rotated from %s to %s, expected from %s to a new key.", gotOld, gotNew, oldFP)
+	}
+
+	if archived != path.Join(dir, "keypair.20240131.txt") {
+		t.Errorf("Archived at %s, expected keypair.20240131.txt.", archived)
+	}
+
+	archivedKey, _, err := useKey(archived)
+	if err != nil || !signer.SameKey(archivedKey.Public(), oldKey.Public()) {
+		t.Errorf("The archived key pair is not the old one: %v", err)
+	}
+
+	newKey, _, err := useKey(filePath)
+	if err != nil {
+		t.Fatalf("Error loading the new key: %v", err)
+	}
+	if fp, _ := signer.Fingerprint(newKey.Public()); fp != gotNew {
+		t.Errorf("The saved key has fingerprint %s, expected %s.", fp, gotNew)
+	}
+
+	// A second rotation on the same day gets its own archive.
+	_, _, archived, err = rotateKey(filePath, "", true, now)
+	if err != nil {
+		t.Fatalf("Error rotating key again: %v", err)
+	}
+	if archived != path.Join(dir, "keypair.20240131.2.txt") {
+		t.Errorf("Archived at %s, expected keypair.20240131.2.txt.", archived)
+	}
+
+	// Without archiving nothing is left behind.
+	_, _, archived, err = rotateKey(filePath, "", false, now)
+	if err != nil || archived != "" {
+		t.Fatalf("Rotating without archiving gave %q, %v.", archived, err)
+	}
+	if _, err := os.Stat(path.Join(dir, "keypair.20240131.3.txt")); !os.IsNotExist(err) {
+		t.Errorf("The old key pair was kept: %v", err)
+	}
+}
+
+func TestRotateKeyRestores(t *testing.T) {
+	filePath := path.Join(t.TempDir(), keyfile)
+
+	oldKey, _, _, err := createSaveKey(filePath, signer.AlgoECDSA, rand.Reader)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+
+	// An unknown algorithm fails after the old key pair was moved aside.
+	_, _, _, err = rotateKey(filePath, "rsa", true, time.Now())
+	if err == nil {
+		t.Fatal("Rotating to an unknown algorithm did not return an error.")
+	}
+
+	loaded, _, err := useKey(filePath)
+	if err != nil || !signer.SameKey(loaded.Public(), oldKey.Public()) {
+		t.Errorf("The old key pair was not put back: %v", err)
+	}
+}
+
+func TestCheckRotatable(t *testing.T) {
+	filePath := path.Join(t.TempDir(), keyfile)
+
+	if _, _, err := (signer.KeyOptions{Identity: "work"}).Create(filePath); err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	identities, err := signer.KeyOptions{}.ListIdentities(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A lone named key pair would be archived and replaced by a default one.
+	if err := checkRotatable(filePath, identities); err == nil || !strings.Contains(err.Error(), `"work"`) {
+		t.Errorf("A file holding only a named key pair gave %v.", err)
+	}
+
+	if err := checkRotatable(filePath, []signer.Identity{{}, {Name: "work"}}); err == nil {
+		t.Error("A file holding two key pairs can be rotated.")
+	}
+	if err := checkRotatable(filePath, []signer.Identity{{}}); err != nil {
+		t.Errorf("A file holding only the default key pair gave %v.", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The selfTest flag checks the install works instead of signing a message.
+var selfTest = flag.Bool("self-test", false, "sign and verify a fixed message with a throwaway key, and report pass or fail")
+
+// The message the self-test signs.
+const selfTestMessage = "crypto-sign-challenge self-test"
+
+// The selfTestKeys are the kinds of key the self-test signs with, as their
+// algorithm and curve.
+var selfTestKeys = [][2]string{
+	{signer.AlgoECDSA, "p256"},
+	{signer.AlgoECDSA, "p384"},
+	{signer.AlgoECDSA, "p521"},
+	{signer.AlgoEd25519, ""},
+}
+
+// The runSelfTest function takes in a writer and, for each kind of key in
+// selfTestKeys, signs selfTestMessage with a new key that is never saved and
+// verifies the signature.  It writes a line saying whether each kind passed or
+// failed, and a last line for the whole test, and returns true if all passed.
+// The key pair file is never read or written.
+func runSelfTest(w io.Writer) bool {
+	passed := true
+
+	for _, kind := range selfTestKeys {
+		name := kind[0]
+		if kind[1] != "" {
+			name += " " + kind[1]
+		}
+
+		if err := selfTestKey(kind[0], kind[1]); err != nil {
+			fmt.Fprintf(w, "%s: fail: %v\n", name, err)
+			passed = false
+			continue
+		}
+		fmt.Fprintf(w, "%s: pass\n", name)
+	}
+
+	if !passed {
+		fmt.Fprintln(w, "self-test: fail")
+		return false
+	}
+
+	fmt.Fprintln(w, "self-test: pass")
+	return true
+}
+
+// The selfTestKey function takes in a key algorithm and curve, as GenerateKey
+// takes them, and creates a key of that kind in memory.  It signs
+// selfTestMessage with it as the signing command does and verifies the signed
+// JSON, and checks that a changed message does not verify.  It returns an
+// error if any step fails.
+func selfTestKey(algo, curve string) error {
+	privKey, err := signer.GenerateKey(algo, curve)
+	if err != nil {
+		return err
+	}
+
+	out, err := signer.Sign(selfTestMessage, privKey, signer.Options{})
+	if err != nil {
+		return err
+	}
+
+	signed, err := marshalJSON(out)
+	if err != nil {
+		return err
+	}
+
+	valid, err := signer.Verify(signed, nil, signer.Options{})
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("the signature does not verify")
+	}
+
+	// A check that passes everything would pass above as well.
+	out.Message += "!"
+	tampered, err := marshalJSON(out)
+	if err != nil {
+		return err
+	}
+	if valid, _ := signer.Verify(tampered, nil, signer.Options{}); valid {
+		return errors.New("a changed message verifies")
+	}
+
+	return nil
+}
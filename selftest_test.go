@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	var out bytes.Buffer
+
+	if !runSelfTest(&out) {
+		t.Errorf("The self-test failed:\n%s", out.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(selfTestKeys)+1 || lines[len(lines)-1] != "self-test: pass" {
+		t.Errorf("Unexpected self-test report:\n%s", out.String())
+	}
+}
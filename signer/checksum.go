@@ -0,0 +1,76 @@
+package signer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrChecksum is returned by Verify when the checksum of the JSON is not the
+// one written in it, so the JSON was changed or corrupted after it was signed.
+var ErrChecksum = errors.New("checksum does not match, the JSON was changed or corrupted")
+
+// The Checksum function takes in signed JSON and returns the checksum of all
+// of its fields but "checksum": the hex SHA256 digest of their canonical
+// serialization, or an error if the JSON is not an object.  The canonical
+// serialization is the JSON object with its keys sorted and no whitespace, as
+// encoding/json writes it, so the checksum does not depend on how the JSON was
+// indented.  It detects corruption in transport, not tampering, since anyone
+// who changes the JSON can write a new checksum.
+func Checksum(contents []byte) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		return "", err
+	}
+	delete(fields, "checksum")
+
+	// Maps are written with their keys sorted.
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// The CheckChecksum function takes in signed JSON and returns nil if it has no
+// checksum or its checksum is right, or an error wrapping ErrChecksum if it
+// is not.  It is quicker than verifying the signature and tells a corrupted
+// file apart from a bad signature.
+func CheckChecksum(contents []byte) error {
+	var out Output
+	if err := json.Unmarshal(contents, &out); err != nil {
+		return err
+	}
+	if out.Checksum == "" {
+		return nil
+	}
+
+	sum, err := Checksum(contents)
+	if err != nil {
+		return err
+	}
+	if sum != out.Checksum {
+		return fmt.Errorf("%w: it is %s, the JSON says %s", ErrChecksum, sum, out.Checksum)
+	}
+	return nil
+}
+
+// The addChecksum function takes in an Output and returns it with its
+// Checksum set, or an error if there is one.
+func addChecksum(out Output) (Output, error) {
+	out.Checksum = ""
+	contents, err := json.Marshal(out)
+	if err != nil {
+		return Output{}, err
+	}
+
+	out.Checksum, err = Checksum(contents)
+	if err != nil {
+		return Output{}, err
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The CanonicalClaims function takes in a JSON object of claims and returns
+// its canonical form: the same object with the keys of every object sorted and
+// no whitespace, as encoding/json writes it.  Numbers are kept as they were
+// written.  It returns an error if the claims are not a single JSON object.
+func CanonicalClaims(claims []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(claims))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("claims are not a JSON object: %v", err)
+	}
+	if fields == nil {
+		return nil, errors.New("claims are not a JSON object: null")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("claims are not a JSON object: there is more after it")
+	}
+
+	// Maps are written with their keys sorted.
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// The checkClaims function takes in the input and the Options of a message
+// being signed as claims, and returns an error if the input is not claims in
+// canonical form or the Options encode it some other way as well.
+func checkClaims(input string, opts Options) error {
+	if opts.Prehashed || opts.EncodeMessage || InputEncodingName(opts.InputEncoding) != InputRaw {
+		return errors.New("claims are signed as canonical JSON, without an input encoding and not as a digest")
+	}
+
+	canonical, err := CanonicalClaims([]byte(input))
+	if err != nil {
+		return err
+	}
+	if string(canonical) != input {
+		return errors.New("claims are not in canonical form, see CanonicalClaims")
+	}
+	return nil
+}
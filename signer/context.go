@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"io"
+)
+
+// The SignContext function takes in a context and the same arguments as Sign,
+// and returns the same as Sign.  If the context is done before the signature is
+// made it returns the error of the context instead, without waiting for the
+// signing to finish, see runContext.  Deterministic signatures use no
+// randomness and are quick, so they are only checked against the context
+// before they start.
+func SignContext(ctx context.Context, input string, privKey crypto.Signer, opts Options) (Output, error) {
+	var (
+		out Output
+		err error
+	)
+
+	if opts.Deterministic {
+		if err := ctx.Err(); err != nil {
+			return Output{}, err
+		}
+		return Sign(input, privKey, opts)
+	}
+
+	opts.Rand = contextReader{ctx, randomSource(opts.Rand)}
+	if ctxErr := runContext(ctx, func() { out, err = Sign(input, privKey, opts) }); ctxErr != nil {
+		return Output{}, ctxErr
+	}
+	return out, err
+}
+
+// The GenerateKeyContext function takes in a context and the same arguments as
+// GenerateKey, and returns the same as GenerateKey, or the error of the context
+// if it is done before the key is made, see runContext.
+func GenerateKeyContext(ctx context.Context, algo, curve string) (crypto.Signer, error) {
+	var (
+		privKey crypto.Signer
+		err     error
+	)
+
+	random := contextReader{ctx, rand.Reader}
+	if ctxErr := runContext(ctx, func() { privKey, err = GenerateKeyFrom(algo, curve, random) }); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return privKey, err
+}
+
+// The runContext function takes in a context and a function, and runs the
+// function unless the context is already done.  It returns nil once the
+// function returns, or the error of the context as soon as it is done, leaving
+// the function to finish on its own with its results unread.
+//
+// The goroutine running the function outlives the call until the function
+// returns.  Callers hand the function a contextReader as its random source, so
+// it stops at its next read once the context is done.  ECDSA in Go 1.26 and
+// later reads no randomness from the caller, so it runs to the end, which
+// takes no longer than one signature or key does.
+func runContext(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// The contextReader struct reads from a source of random bytes until its
+// context is done, and returns the error of the context after that, so a
+// signature or key being made for a caller that gave up stops early.
+type contextReader struct {
+	ctx    context.Context
+	random io.Reader
+}
+
+// The Read method takes in a slice of bytes and fills it from the random
+// source, or returns the error of the context if it is done.
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.random.Read(p)
+}
@@ -0,0 +1,60 @@
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSignContext(t *testing.T) {
+	privKey, _ := keyContents()
+
+	for _, opts := range []Options{{}, {Deterministic: true}} {
+		out, err := SignContext(context.Background(), "Hello", privKey, opts)
+		if err != nil {
+			t.Fatalf("Error signing message: %v", err)
+		}
+
+		signed, err := json.Marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid, err := Verify(signed, nil, opts); err != nil || !valid {
+			t.Errorf("The signature made with a context does not verify: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := SignContext(ctx, "Hello", privKey, opts); !errors.Is(err, context.Canceled) {
+			t.Errorf("Signing with a canceled context returned %v, expected %v.", err, context.Canceled)
+		}
+	}
+
+	if _, err := GenerateKeyContext(context.Background(), AlgoEd25519, ""); err != nil {
+		t.Errorf("Error generating key: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GenerateKeyContext(ctx, AlgoECDSA, "p521"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Generating a key with a canceled context returned %v, expected %v.", err, context.Canceled)
+	}
+}
+
+func TestContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	random := contextReader{ctx, rand.Reader}
+
+	if _, err := GenerateKeyFrom(AlgoEd25519, "", random); err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	// Once the context is done, a key still being made stops at its next
+	// read of random bytes.
+	cancel()
+	if _, err := GenerateKeyFrom(AlgoEd25519, "", random); !errors.Is(err, context.Canceled) {
+		t.Errorf("Generating a key after the context was canceled returned %v, expected %v.", err, context.Canceled)
+	}
+}
@@ -0,0 +1,139 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// The PEM type of an encrypted private key.  It is not the PKCS#8 "ENCRYPTED
+// PRIVATE KEY" type because the encryption is the tool's own, described by the
+// headers of the block.
+const EncryptedKeyType = "SIGNER ENCRYPTED PRIVATE KEY"
+
+// The key derivation and cipher used for encrypted private keys.  The names are
+// written into the PEM headers so the parameters can change later without
+// breaking old keyfiles.
+const (
+	encryptKDF        = "PBKDF2-SHA256"
+	encryptCipher     = "AES-256-GCM"
+	encryptIterations = 600000
+	encryptSaltSize   = 16
+)
+
+// The most PBKDF2 iterations a keyfile may ask for.  The count comes from the
+// file, so without a limit a tampered keyfile could make decrypting it take
+// hours.
+const maxEncryptIterations = 10 * encryptIterations
+
+// The EncryptPrivateKey function takes in a private key and a passphrase and
+// returns a PEM block holding the PKCS#8 form of the key encrypted with
+// AES-256-GCM, under a key derived from the passphrase with PBKDF2.  The KDF,
+// its iterations and salt, the cipher and its nonce are kept in the headers of
+// the block.  It returns an error if there is one.
+func EncryptPrivateKey(privKey crypto.Signer, passphrase string) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, encryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, encryptIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{
+		Type: EncryptedKeyType,
+		Headers: map[string]string{
+			"KDF":        encryptKDF,
+			"Iterations": strconv.Itoa(encryptIterations),
+			"Salt":       hex.EncodeToString(salt),
+			"Cipher":     encryptCipher,
+			"Nonce":      hex.EncodeToString(nonce),
+		},
+		Bytes: aead.Seal(nil, nonce, der, nil),
+	}, nil
+}
+
+// The DecryptPrivateKey function takes in a PEM block written by
+// EncryptPrivateKey and the passphrase, and returns a "PRIVATE KEY" PEM block
+// holding the decrypted PKCS#8 key, or an error if the headers are not
+// understood or the passphrase is wrong.
+func DecryptPrivateKey(block *pem.Block, passphrase string) (*pem.Block, error) {
+	if block.Headers["KDF"] != encryptKDF || block.Headers["Cipher"] != encryptCipher {
+		return nil, fmt.Errorf("private key is encrypted with %s and %s, only %s and %s are supported",
+			block.Headers["KDF"], block.Headers["Cipher"], encryptKDF, encryptCipher)
+	}
+
+	iterations, err := strconv.Atoi(block.Headers["Iterations"])
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("private key has bad KDF iterations %q", block.Headers["Iterations"])
+	}
+	if iterations > maxEncryptIterations {
+		return nil, fmt.Errorf("private key asks for %d KDF iterations, at most %d are allowed", iterations, maxEncryptIterations)
+	}
+
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("private key has a bad salt: %v", err)
+	}
+
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, fmt.Errorf("private key has a bad nonce: %v", err)
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("private key nonce is %d bytes, expected %d", len(nonce), aead.NonceSize())
+	}
+
+	// GCM checks the tag, so a wrong passphrase fails here rather than giving
+	// back garbage.
+	der, err := aead.Open(nil, nonce, block.Bytes, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase for the private key")
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// The passphraseCipher function takes in a passphrase, a salt and the number of
+// PBKDF2 iterations and returns the AES-256-GCM cipher keyed with the key
+// derived from them, or an error if there is one.
+func passphraseCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
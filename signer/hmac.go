@@ -0,0 +1,45 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// The tag hashed ahead of an HMAC key to make its key ID, so the ID is never
+// the plain digest of the key.
+const hmacKeyIDTag = "crypto-sign-challenge hmac key id v1\x00"
+
+// The HMACKeyID function takes in an HMAC key and returns the ID written to the
+// output of a message signed with it: the first 8 bytes of the SHA256 digest of
+// hmacKeyIDTag and the key, hex encoded.  It tells a verifier which shared
+// secret to use without giving the secret away.
+func HMACKeyID(key []byte) string {
+	digest := sha256.Sum256(append([]byte(hmacKeyIDTag), key...))
+	return hex.EncodeToString(digest[:8])
+}
+
+// The Digest function takes in a message and the Options, and returns the
+// digest an ECDSA key signs for it: the HMAC of the message keyed with the
+// HMACKey of the Options if there is one, or else the plain digest, in both
+// cases with the Hash of the Options.  It returns an error if the hash is
+// unknown.
+func Digest(message string, opts Options) ([]byte, error) {
+	if len(opts.HMACKey) == 0 {
+		return HashSum(opts.Hash, message)
+	}
+
+	h, err := HashFunc(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(h.New, opts.HMACKey)
+	mac.Write([]byte(message))
+	return mac.Sum(nil), nil
+}
+
+// The error Verify returns for a message signed with an HMAC key when the
+// Options have no HMACKey to check it with.
+var ErrNeedsHMACKey = errors.New("the message was signed with an HMAC key, the same key is needed to verify it")
@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The PEM header naming the key pair a block belongs to, in a keyfile holding
+// several.  The default key pair has no such header, so a keyfile holding one
+// key pair is written as it always was.
+const IdentityHeader = "Identity"
+
+// The Identity struct holds one key pair of a keyfile, as
+// KeyOptions.ListIdentities finds it: its name, empty for the default key
+// pair, and its public key.
+type Identity struct {
+	Name      string
+	PublicKey crypto.PublicKey
+}
+
+// The CheckIdentity function takes in the name of a key pair and returns an
+// error if it can not be written into a PEM header: names are letters, digits,
+// ".", "_" and "-".  An empty name, the default key pair, is allowed.
+func CheckIdentity(name string) error {
+	if strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-") != "" {
+		return fmt.Errorf("identity %q can only have letters, digits, \".\", \"_\" and \"-\"", name)
+	}
+	return nil
+}
+
+// The ListIdentities method takes in the file path of a key pair file and
+// returns the key pairs it holds, in the order they are saved, or an error if
+// the file can not be read or a public key can not be parsed.  Only the public
+// keys are read, so no passphrase is needed.
+func (o KeyOptions) ListIdentities(filePath string) ([]Identity, error) {
+	contents, err := o.readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var identities []Identity
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		pubKey, err := PublicKeyFromBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("keyfile %s has a bad public key: %v", filePath, err)
+		}
+
+		identities = append(identities, Identity{Name: block.Headers[IdentityHeader], PublicKey: pubKey})
+	}
+
+	return identities, nil
+}
+
+// The HasKeyPair method takes in the file path of a key pair file and returns
+// true if the key pair named by Identity is saved in it, or an error if the
+// file exists but can not be read.  A file that holds no key pair at all, such
+// as a damaged one, counts as holding the default key pair, so it is never
+// written over without being asked.
+func (o KeyOptions) HasKeyPair(filePath string) (bool, error) {
+	contents, err := o.readFile(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return o.holdsKeyPair(contents), nil
+}
+
+// The holdsKeyPair method takes in the contents of a key pair file and returns
+// true if the key pair named by Identity is in them, as HasKeyPair does.
+func (o KeyOptions) holdsKeyPair(contents []byte) bool {
+	if identityRegion(contents, o.Identity) != nil {
+		return true
+	}
+	return o.Identity == "" && !hasKeyPairs(contents)
+}
+
+// The isPrivateBlock function takes in the type of a PEM block and returns true
+// if it is one of the private key types a key pair file can start with.
+func isPrivateBlock(blockType string) bool {
+	switch blockType {
+	case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY", EncryptedKeyType, PKCS8EncryptedType:
+		return true
+	default:
+		return false
+	}
+}
+
+// The hasKeyPairs function takes in the contents of a key pair file and returns
+// true if it holds at least one private key block.
+func hasKeyPairs(contents []byte) bool {
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		if isPrivateBlock(block.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// The identityRegion function takes in the contents of a key pair file and the
+// name of a key pair, and returns the contents from the private key block of
+// that key pair on, so its public key block is the block after it.  It returns
+// nil if the key pair is not in the file.
+func identityRegion(contents []byte, name string) []byte {
+	rest := contents
+	for {
+		block, next := pem.Decode(rest)
+		if block == nil {
+			return nil
+		}
+		if isPrivateBlock(block.Type) && block.Headers[IdentityHeader] == name {
+			return rest
+		}
+		rest = next
+	}
+}
+
+// The otherIdentities function takes in the contents of a key pair file and the
+// name of a key pair, and returns the blocks of every other key pair, PEM
+// encoded in the order they are saved.  The default key pair comes back first
+// so older versions, which read only the first key pair, still find it.
+func otherIdentities(contents []byte, name string) []byte {
+	var defaults, named bytes.Buffer
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		blockName := block.Headers[IdentityHeader]
+		switch {
+		case blockName == name:
+		case blockName == "":
+			pem.Encode(&defaults, block)
+		default:
+			pem.Encode(&named, block)
+		}
+	}
+	return append(defaults.Bytes(), named.Bytes()...)
+}
@@ -0,0 +1,641 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The KeyOptions struct holds the choices used when a key pair file is loaded
+// or created.  The zero value creates ECDSA P-521 keys, saves them unencrypted
+// and can not load an encrypted key.
+type KeyOptions struct {
+	// Algorithm is the algorithm of a new key, "ecdsa" or "ed25519".  Empty
+	// means "ecdsa".
+	Algorithm string
+
+	// Curve is the curve of a new ECDSA key, "p256", "p384" or "p521".  Empty
+	// means "p521".
+	Curve string
+
+	// PKCS8 saves a new ECDSA private key in PKCS#8 form, as a "PRIVATE KEY"
+	// block, instead of in SEC1 form as an "EC PRIVATE KEY" block.
+	PKCS8 bool
+
+	// Encrypt saves a new private key encrypted with the passphrase.
+	Encrypt bool
+
+	// Passphrase is called for the passphrase of an encrypted private key,
+	// with confirm set when a new passphrase is being chosen.
+	Passphrase func(confirm bool) (string, error)
+
+	// Identity is the name of the key pair to use in a keyfile holding
+	// several.  Empty means the default key pair, saved without a name.
+	Identity string
+
+	// Logf, if set, is called to report which key pair file is used.
+	Logf func(format string, a ...interface{})
+
+	// Rand is the source of random bytes a new key is made from.  Nil means
+	// crypto/rand.Reader.
+	Rand io.Reader
+
+	// Created, if set, is called with the new private key once Create has
+	// saved it, so a key pair created on first use can be reported.
+	Created func(privKey crypto.Signer)
+
+	// FS, if set, is what key pair and key files are read from, in place of
+	// the disk.  They are still written to the disk.
+	FS FileSystem
+
+	// Mode is the permissions a key pair file is saved with.  Zero means
+	// DefaultKeyfileMode, Owner read/write only.
+	Mode os.FileMode
+
+	// AllowInsecureMode allows a Mode that lets every user read or write the
+	// key pair file, which Save refuses otherwise.
+	AllowInsecureMode bool
+}
+
+// ErrInsecureMode is returned by Save when Mode lets every user read or write
+// the key pair file and AllowInsecureMode is not set.
+var ErrInsecureMode = errors.New("the key pair file mode lets every user at the private key")
+
+// DefaultKeyfileMode is the permissions a key pair file is saved with unless
+// KeyOptions.Mode says otherwise: Owner read/write only.
+const DefaultKeyfileMode os.FileMode = 0600
+
+// The mode method returns the permissions a key pair file is saved with, or an
+// error if Mode does not let the owner read and write the file, or lets every
+// user at it without AllowInsecureMode.
+func (o KeyOptions) mode() (os.FileMode, error) {
+	if o.Mode == 0 {
+		return DefaultKeyfileMode, nil
+	}
+
+	mode := o.Mode
+	if mode&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("key pair file mode %v is not just permissions", mode)
+	}
+	if mode&0600 != 0600 {
+		return 0, fmt.Errorf("key pair file mode %04o does not let the owner read and write it", uint32(mode))
+	}
+	if mode&0007 != 0 && !o.AllowInsecureMode {
+		return 0, fmt.Errorf("%w: it is %04o", ErrInsecureMode, uint32(mode))
+	}
+	return mode, nil
+}
+
+// The FileSystem interface is the file access KeyOptions reads key files with,
+// so tests can read them from memory, for example from an fstest.MapFS.  A file
+// that does not exist must give an error that os.IsNotExist reports.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// The LoadOrCreateKey function takes in the file path of the key pair file and
+// returns the private key and the public key in a PEM formatted string, loading
+// them with the zero KeyOptions, or an error if there is one.
+func LoadOrCreateKey(filePath string) (crypto.Signer, string, error) {
+	return KeyOptions{}.LoadOrCreate(filePath)
+}
+
+// The LoadOrCreate method takes in the file path of the key pair file.  It
+// returns the private key and the public key in a PEM formatted string,
+// creating and saving a new key pair first if the file does not exist, or does
+// not hold the key pair named by Identity, or an error if there is one.
+func (o KeyOptions) LoadOrCreate(filePath string) (crypto.Signer, string, error) {
+	// The file is read once, and the key pair is loaded from what was read,
+	// so it can not change between checking for the key pair and loading it.
+	contents, err := o.readFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+
+	// If the key pair does not exist, create it.
+	if err != nil || !o.holdsKeyPair(contents) {
+		return o.createLocked(filePath)
+	}
+
+	o.logf("Loading the key pair from %s", filePath)
+	return o.parseKeyPair(filePath, contents)
+}
+
+// How long LoadOrCreate waits for another process creating the same key pair,
+// and how old a lock file must be before it is taken to be left behind by a
+// process that died.
+const (
+	lockWait  = 10 * time.Second
+	lockStale = time.Minute
+)
+
+// The createLocked method takes in the file path of a key pair file that did
+// not exist.  It holds the lock file next to it while it creates the key pair,
+// so two processes started at once do not both create one and overwrite each
+// other.  The process that waited loads the key pair the other one saved.  The
+// passphrase of an encrypted key pair is asked for before the lock is taken, so
+// a prompt left unanswered does not keep other processes waiting.  It returns
+// the same as LoadOrCreate.
+func (o KeyOptions) createLocked(filePath string) (crypto.Signer, string, error) {
+	if o.Encrypt {
+		passphrase, err := o.passphrase(true)
+		if err != nil {
+			return nil, "", err
+		}
+		o.Passphrase = func(bool) (string, error) { return passphrase, nil }
+	}
+
+	unlock, err := lockFile(filePath + ".lock")
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+
+	// Another process may have created the key pair while this one waited.
+	contents, err := o.readFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+	if err == nil && o.holdsKeyPair(contents) {
+		o.logf("Loading the key pair from %s, created while waiting", filePath)
+		return o.parseKeyPair(filePath, contents)
+	}
+
+	o.logf("No key pair at %s, creating a new one", filePath)
+	privKey, pubKey, err := o.Create(filePath)
+
+	// A new key pair file is only ever created exclusively, so if one that
+	// does not take the lock got there first, its key pair is used instead.
+	if os.IsExist(err) {
+		o.logf("Loading the key pair from %s, created by another process", filePath)
+		return o.Load(filePath)
+	}
+	return privKey, pubKey, err
+}
+
+// The lockFile function takes in the path of a lock file and creates it,
+// failing if it exists, so only one process at a time holds it.  It waits up to
+// lockWait for another holder to let go, and removes a lock file older than
+// lockStale.  It returns a function that removes the lock file, or an error if
+// the lock can not be had.
+func lockFile(lockPath string) (func(), error) {
+	deadline := time.Now().Add(lockWait)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			addPending(lockPath)
+			return func() { removePending(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		// A process that died while holding the lock never removes it.
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockStale {
+			breakStaleLock(lockPath, info)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is held by another process, remove it if none is running", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// The breakStaleLock function takes in the path of a lock file and what
+// os.Stat returned for it when it was found to be stale, and removes it.
+// Another waiter may have removed the same lock and taken a new one since, so
+// the lock file is first renamed to a name of its own, which only one waiter
+// can do, and only removed if it is still the stale one, by inode and by
+// modification time, as a new lock may be given the inode of the one removed.
+// A new lock renamed by mistake is linked back in place, unless yet another
+// lock has been taken.
+func breakStaleLock(lockPath string, stale os.FileInfo) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return
+	}
+	moved := fmt.Sprintf("%s.%x", lockPath, suffix)
+	if err := os.Rename(lockPath, moved); err != nil {
+		return
+	}
+
+	info, err := os.Stat(moved)
+	if err == nil && (!os.SameFile(info, stale) || !info.ModTime().Equal(stale.ModTime())) {
+		os.Link(moved, lockPath)
+	}
+	os.Remove(moved)
+}
+
+// The Create method takes in the file path where you want to save the
+// eventualy created key pair to in one string, and returns the private key, and
+// the public key in a PEM formatted string, or an error if there is one.
+func (o KeyOptions) Create(filePath string) (crypto.Signer, string, error) {
+	// Generate a new private key of the chosen algorithm, reading from random.
+	privateKey, err := GenerateKeyFrom(o.Algorithm, o.Curve, randomSource(o.Rand))
+	if err != nil {
+		return nil, "", err
+	}
+
+	pubKey, err := o.Save(filePath, privateKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if o.Created != nil {
+		o.Created(privateKey)
+	}
+
+	return privateKey, pubKey, nil
+}
+
+// The Save method takes in the file path where you want to save the key
+// pair and the private key.  It writes the private key and its public key to
+// the file in PEM format, under the name in Identity, in place of the key pair
+// of that name and keeping any others, with the permissions in Mode, and
+// returns the public key in a PEM formatted string, or an error if there is
+// one.
+func (o KeyOptions) Save(filePath string, privateKey crypto.Signer) (string, error) {
+	// The mode is checked before anything is written.
+	mode, err := o.mode()
+	if err != nil {
+		return "", err
+	}
+
+	// Set pubKey to the Public Key that corresponds to the Private Key
+	// generated earlier (privateKey)
+	pubKey := privateKey.Public()
+
+	// The MarshalPKIXPublicKey function from the x509 package takes the public
+	// key (pubKey) then serialises it to DER-encoded PKIX format which is
+	// returned as a slice of bytes(pemPubSlice) or returns an error (err)
+	pemPubSlice, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Create PEM encoded structure(Block) with the form:
+	/*
+		-----BEGIN Type-----
+		base64-encoded Bytes
+		-----END Type-----
+	*/
+	// where Type = "PUBLIC KEY" and the bytes to be encoded to base64 are pemPubSlice
+	var pemPubKey = &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pemPubSlice}
+
+	// This sets the PEM block (pemPubKey) to a variable (encPubPem) to be used later.
+	encPubPem := pem.EncodeToMemory(pemPubKey)
+
+	// The next section encodes the private key to PEM format just like the public
+	// key was encoded earlier and then it is set to a variable as well.
+	pemPrivKey, err := MarshalPrivateKey(privateKey, o.PKCS8)
+	if err != nil {
+		return "", err
+	}
+
+	// With Encrypt the private key is saved encrypted with a passphrase.
+	if o.Encrypt {
+		passphrase, err := o.passphrase(true)
+		if err != nil {
+			return "", err
+		}
+
+		pemPrivKey, err = EncryptPrivateKey(privateKey, passphrase)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// A named key pair has its name in the headers of both blocks.
+	if o.Identity != "" {
+		if err := CheckIdentity(o.Identity); err != nil {
+			return "", err
+		}
+		if pemPrivKey.Headers == nil {
+			pemPrivKey.Headers = map[string]string{}
+		}
+		pemPrivKey.Headers[IdentityHeader] = o.Identity
+		pemPubKey.Headers = map[string]string{IdentityHeader: o.Identity}
+	}
+
+	encPrivPem := pem.EncodeToMemory(pemPrivKey)
+	namedPubPem := pem.EncodeToMemory(pemPubKey)
+
+	// The other key pairs in the file are kept, with the default one first.
+	contents, err := o.readFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	others := otherIdentities(contents, o.Identity)
+
+	// This writes the PEM encoded private key and public key to the file, all
+	// at once so a crash part way through never leaves half a key pair behind.
+	// A file that did not exist is created exclusively, so a file that appears
+	// in the meantime is never replaced.
+	write := func(w io.Writer) error {
+		if o.Identity == "" {
+			return WriteAll(w, encPrivPem, namedPubPem, others)
+		}
+		return WriteAll(w, others, encPrivPem, namedPubPem)
+	}
+	err = writeFileAtomic(filePath, os.IsNotExist(err), mode, write)
+	if err != nil {
+		return "", err
+	}
+
+	// Return the string of the PEM encoded public key and no error.
+	return string(encPubPem), nil
+}
+
+// The WriteFileAtomic function takes in a file path and a function that writes
+// the contents of the file.  It writes the contents to a temporary file, with
+// Owner read/write permission, in the same directory, syncs it to disk and then
+// renames it to the file path, so the file is either written completely or not
+// at all.  It returns an error if any step fails, leaving no temporary file.
+func WriteFileAtomic(filePath string, write func(io.Writer) error) error {
+	return writeFileAtomic(filePath, false, DefaultKeyfileMode, write)
+}
+
+// The WriteFileExclusive function takes in a file path and a function that
+// writes the contents of the file, and writes the file as WriteFileAtomic does,
+// but only if there is no file at the path.  The complete temporary file is
+// hard linked to the path, which fails if a file is there, the same as opening
+// it with O_CREATE|O_EXCL would.  It returns an error that os.IsExist reports
+// if there is a file at the path, leaving that file as it is.
+func WriteFileExclusive(filePath string, write func(io.Writer) error) error {
+	return writeFileAtomic(filePath, true, DefaultKeyfileMode, write)
+}
+
+// The writeFileAtomic function takes in a file path, whether the file must not
+// exist yet, the permissions of the file and a function that writes the
+// contents of the file, and does the work of WriteFileAtomic and
+// WriteFileExclusive.
+func writeFileAtomic(filePath string, exclusive bool, mode os.FileMode, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// Removing the temporary file fails harmlessly once it has been renamed,
+	// and removes the other name of a linked file.
+	addPending(tmp.Name())
+	defer removePending(tmp.Name())
+
+	// The temporary file is made Owner read/write only, and only given other
+	// permissions before anything is written to it.
+	if mode != DefaultKeyfileMode {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = write(tmp)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if exclusive {
+		return os.Link(tmp.Name(), filePath)
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// The WriteAll function takes in a writer and slices of bytes and writes each
+// slice in turn, returning an error if any write fails or is short.
+func WriteAll(w io.Writer, chunks ...[]byte) error {
+	for _, chunk := range chunks {
+		n, err := w.Write(chunk)
+		if err != nil {
+			return err
+		}
+		if n != len(chunk) {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
+}
+
+// The Load method takes in the file path of the file where the private and
+// public key pair are saved in PEM format and returns the private key and the
+// public key in a PEM formatted string, or an error if there is one.
+func (o KeyOptions) Load(filePath string) (crypto.Signer, string, error) {
+	// Reads the entire file and saves the contents as a string or returns error.
+	contents, err := o.readFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return o.parseKeyPair(filePath, contents)
+}
+
+// The parseKeyPair method takes in the file path of a key pair file and its
+// contents, and returns the private key and the public key in a PEM formatted
+// string of the key pair named by Identity, or an error if there is one.  The
+// file path is only used in errors.
+func (o KeyOptions) parseKeyPair(filePath string, contents []byte) (crypto.Signer, string, error) {
+	// Decodes the contents into 2 variables (block & rest); setting block to the
+	// first PEM block contained in contents.
+	// The contents of the file should be a private key PEM block and the
+	// corresponding public key PEM block as that is how the file was originally
+	// created.  Both are checked below.
+	//
+	// A keyfile holding several key pairs is read from the private key block of
+	// the one named by Identity.  If it is not there, block is nil and the error
+	// below says so.
+	region := identityRegion(contents, o.Identity)
+	if region == nil && o.Identity != "" {
+		return nil, "", fmt.Errorf("keyfile %s has no key pair named %q", filePath, o.Identity)
+	}
+	if region == nil && hasKeyPairs(contents) {
+		return nil, "", fmt.Errorf("keyfile %s has no default key pair, only named ones, use --identity", filePath)
+	}
+	if region == nil {
+		region = contents
+	}
+	block, rest := pem.Decode(region)
+
+	// OpenSSL writes RSA keys in PKCS#1 form under their own type.
+	if block != nil && block.Type == "RSA PRIVATE KEY" {
+		return nil, "", unsupportedKeyfile(filePath, &UnsupportedKeyError{Kind: "an RSA"})
+	}
+
+	// An encrypted private key, the tool's own or OpenSSL's, is decrypted
+	// with the passphrase first.
+	if block != nil && (block.Type == EncryptedKeyType || block.Type == PKCS8EncryptedType) {
+		passphrase, err := o.passphrase(false)
+		if err != nil {
+			return nil, "", err
+		}
+
+		block, err = decryptBlock(block, passphrase)
+		if err != nil {
+			return nil, "", fmt.Errorf("keyfile %s: %v", filePath, err)
+		}
+	}
+
+	// An empty or damaged file has no PEM block at all, and block is nil.
+	// ECDSA keys can be in either form, see ParsePrivateKey.
+	if block == nil || (block.Type != "PRIVATE KEY" && block.Type != "EC PRIVATE KEY") {
+		return nil, "", fmt.Errorf("keyfile %s is corrupt or not a PEM private key", filePath)
+	}
+
+	privateKey, err := ParsePrivateKey(block)
+	if err != nil {
+		return nil, "", unsupportedKeyfile(filePath, err)
+	}
+
+	// Keyfiles written before the label was fixed still load, the label is
+	// only reported so the key can be moved to the right one.
+	if LegacyLabel(block) {
+		o.logf("Keyfile %s labels its SEC1 private key \"PRIVATE KEY\" instead of \"EC PRIVATE KEY\"", filePath)
+	}
+
+	// The public key PEM block (pubBlock) has to hold the public half of the
+	// private key, otherwise the file was tampered with or only partly written.
+	// A file whose public key was never written, with nothing after the
+	// private key, has it derived from the private key instead.
+	if len(bytes.TrimSpace(rest)) == 0 {
+		o.logf("Keyfile %s has no public key after the private key, deriving it from the private key", filePath)
+		publicKey, err := PublicKeyPEM(privateKey.Public())
+		if err != nil {
+			return nil, "", err
+		}
+		return privateKey, publicKey, nil
+	}
+
+	pubBlock, _ := pem.Decode(rest)
+	if pubBlock == nil || pubBlock.Type != "PUBLIC KEY" {
+		return nil, "", fmt.Errorf("keyfile %s has no PEM public key after the private key", filePath)
+	}
+
+	pubKey, err := PublicKeyFromBlock(pubBlock)
+	if err != nil {
+		return nil, "", fmt.Errorf("keyfile %s has a bad public key: %v", filePath, err)
+	}
+
+	if !SameKey(privateKey.Public(), pubKey) {
+		return nil, "", fmt.Errorf("keyfile %s has a public key that does not match the private key", filePath)
+	}
+
+	// The name of the key pair is left out of the public key given back.
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: pubBlock.Type, Bytes: pubBlock.Bytes}))
+
+	return privateKey, publicKey, nil
+}
+
+// The LoadPrivateKey method takes in the path of a PEM file holding a private
+// key that the tool does not manage, for example one made with OpenSSL.  It
+// returns the private key and its public key in a PEM formatted string, or an
+// error if there is one.  The key may be an "EC PRIVATE KEY" (SEC1) block, a
+// "PRIVATE KEY" (PKCS#8 or SEC1) block, an "ENCRYPTED PRIVATE KEY" (PKCS#8
+// with PBES2) block or a key encrypted by the tool, other blocks such as
+// "EC PARAMETERS" are skipped, and the file is never written.
+func (o KeyOptions) LoadPrivateKey(filePath string) (crypto.Signer, string, error) {
+	contents, err := o.readFile(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for block, rest := pem.Decode(contents); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return nil, "", fmt.Errorf("key file %s: %v", filePath, &UnsupportedKeyError{Kind: "an RSA"})
+		case EncryptedKeyType, PKCS8EncryptedType:
+			passphrase, err := o.passphrase(false)
+			if err != nil {
+				return nil, "", err
+			}
+
+			block, err = decryptBlock(block, passphrase)
+			if err != nil {
+				return nil, "", fmt.Errorf("key file %s: %v", filePath, err)
+			}
+		case "PRIVATE KEY", "EC PRIVATE KEY":
+		default:
+			continue
+		}
+
+		privateKey, err := ParsePrivateKey(block)
+		if err != nil {
+			return nil, "", fmt.Errorf("key file %s: %v", filePath, err)
+		}
+
+		publicKey, err := PublicKeyPEM(privateKey.Public())
+		if err != nil {
+			return nil, "", err
+		}
+
+		return privateKey, publicKey, nil
+	}
+
+	return nil, "", fmt.Errorf("key file %s has no PEM private key", filePath)
+}
+
+// The decryptBlock function takes in a private key PEM block encrypted either
+// by the tool or by OpenSSL and the passphrase, and returns the decrypted
+// block, or an error if the passphrase is wrong.
+func decryptBlock(block *pem.Block, passphrase string) (*pem.Block, error) {
+	if block.Type == PKCS8EncryptedType {
+		return DecryptPKCS8(block, passphrase)
+	}
+	return DecryptPrivateKey(block, passphrase)
+}
+
+// The unsupportedKeyfile function takes in the file path of the key pair file
+// and the error ParsePrivateKey returned for it, and returns the error to
+// report.  A key of a kind the tool can not use gets a message saying so and
+// how to replace it, rather than the error of the parser.
+func unsupportedKeyfile(filePath string, err error) error {
+	var unsupported *UnsupportedKeyError
+	if errors.As(err, &unsupported) {
+		return fmt.Errorf("keyfile %s contains %s key but an ECDSA or Ed25519 key was expected; run keygen --force to regenerate it",
+			filePath, unsupported.Kind)
+	}
+
+	return fmt.Errorf("keyfile %s has a private key that can not be parsed: %v", filePath, err)
+}
+
+// The passphrase method takes in whether the passphrase is being chosen rather
+// than entered and returns it from the Passphrase function, or an error if
+// there is no Passphrase function or it fails.
+func (o KeyOptions) passphrase(confirm bool) (string, error) {
+	if o.Passphrase == nil {
+		return "", errors.New("the private key needs a passphrase but none can be asked for")
+	}
+	return o.Passphrase(confirm)
+}
+
+// The readFile method takes in the path of a file and returns its contents,
+// read from FS if it is set and from the disk otherwise, or an error if there
+// is one.
+func (o KeyOptions) readFile(filePath string) ([]byte, error) {
+	if o.FS != nil {
+		return o.FS.ReadFile(filePath)
+	}
+	return os.ReadFile(filePath)
+}
+
+// The logf method passes the message to the Logf function, if there is one.
+func (o KeyOptions) logf(format string, a ...interface{}) {
+	if o.Logf != nil {
+		o.Logf(format, a...)
+	}
+}
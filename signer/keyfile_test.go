@@ -0,0 +1,730 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	for _, algo := range []string{AlgoECDSA, AlgoEd25519} {
+		filePath := path.Join(t.TempDir(), "keypair.txt")
+
+		privKey, pubKey, err := KeyOptions{Algorithm: algo}.Create(filePath)
+		if err != nil {
+			t.Fatalf("Error creating %s key: %v", algo, err)
+		}
+
+		loaded, loadedPub, err := KeyOptions{}.Load(filePath)
+		if err != nil {
+			t.Fatalf("Error loading %s key: %v", algo, err)
+		}
+
+		if KeyAlgorithm(loaded) != algo {
+			t.Errorf("Loaded a %s key, expected %s.", KeyAlgorithm(loaded), algo)
+		}
+
+		if loadedPub != pubKey {
+			t.Errorf("Loaded %s public key does not match the saved one.", algo)
+		}
+
+		loadedFP, _ := Fingerprint(loaded.Public())
+		savedFP, _ := Fingerprint(privKey.Public())
+		if loadedFP != savedFP {
+			t.Errorf("Loaded %s private key does not match the saved one.", algo)
+		}
+	}
+}
+
+func TestLoadOrCreateConcurrent(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+	opts := KeyOptions{Curve: "p256"}
+
+	// Every call races to create the missing key pair, and all of them must
+	// end up with the one key that was saved.
+	const calls = 8
+	pubKeys := make(chan string, calls)
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		go func() {
+			_, pubKey, err := opts.LoadOrCreate(filePath)
+			pubKeys <- pubKey
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < calls; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Error loading or creating key: %v", err)
+		}
+	}
+
+	_, saved, err := opts.Load(filePath)
+	if err != nil {
+		t.Fatalf("Error loading key: %v", err)
+	}
+
+	for i := 0; i < calls; i++ {
+		if pubKey := <-pubKeys; pubKey != saved {
+			t.Error("A call returned a key other than the saved one.")
+		}
+	}
+
+	if _, err := os.Stat(filePath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("The lock file was left behind: %v", err)
+	}
+}
+
+func TestIdentities(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+
+	defaultKey, defaultPub, err := KeyOptions{Curve: "p256"}.LoadOrCreate(filePath)
+	if err != nil {
+		t.Fatalf("Error creating default key: %v", err)
+	}
+
+	// A keyfile with only the default key pair is written as it always was.
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(contents), IdentityHeader) {
+		t.Errorf("The default key pair was saved with a name:\n%s", contents)
+	}
+
+	work := KeyOptions{Curve: "p256", Identity: "work"}
+	workKey, workPub, err := work.LoadOrCreate(filePath)
+	if err != nil {
+		t.Fatalf("Error creating named key: %v", err)
+	}
+	if SameKey(workKey.Public(), defaultKey.Public()) {
+		t.Error("The named key pair is the default one.")
+	}
+	if strings.Contains(workPub, IdentityHeader) {
+		t.Errorf("The public key was given back with its name:\n%s", workPub)
+	}
+
+	// Both key pairs load from the same file.
+	_, pub, err := KeyOptions{}.Load(filePath)
+	if err != nil || pub != defaultPub {
+		t.Errorf("The default key pair did not load after adding another: %v", err)
+	}
+	_, pub, err = work.Load(filePath)
+	if err != nil || pub != workPub {
+		t.Errorf("The named key pair did not load: %v", err)
+	}
+
+	if _, _, err := (KeyOptions{Identity: "home"}).Load(filePath); err == nil {
+		t.Error("A missing key pair loaded.")
+	}
+
+	// Replacing one key pair keeps the others.
+	newDefault, err := GenerateKey(AlgoEd25519, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (KeyOptions{}).Save(filePath, newDefault); err != nil {
+		t.Fatalf("Error replacing default key: %v", err)
+	}
+
+	identities, err := (KeyOptions{}).ListIdentities(filePath)
+	if err != nil {
+		t.Fatalf("Error listing key pairs: %v", err)
+	}
+	if len(identities) != 2 || identities[0].Name != "" || identities[1].Name != "work" {
+		t.Fatalf("Listed %+v, expected the default key pair then \"work\".", identities)
+	}
+	if !SameKey(identities[0].PublicKey, newDefault.Public()) || !SameKey(identities[1].PublicKey, workKey.Public()) {
+		t.Error("The listed public keys are not the saved ones.")
+	}
+
+	if _, _, err := (KeyOptions{Identity: "bad name"}).Create(filePath); err == nil {
+		t.Error("A name with a space was saved.")
+	}
+}
+
+func TestEd25519Sign(t *testing.T) {
+	_, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKey, err := KeyOptions{}.Save(path.Join(t.TempDir(), "keypair.txt"), privKey)
+	if err != nil {
+		t.Fatalf("Error saving key: %v", err)
+	}
+
+	signed, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	decSign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		t.Fatalf("Error decoding signature: %v", err)
+	}
+
+	if out.PubKey != pubKey {
+		t.Error("Output public key does not match the saved public key.")
+	}
+
+	if len(decSign) != ed25519.SignatureSize {
+		t.Errorf("Signature is %d bytes, expected %d.", len(decSign), ed25519.SignatureSize)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("The Ed25519 signature does not verify: %v", err)
+	}
+}
+
+func TestUseKeyCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"empty":   "",
+		"garbage": "this is not a key pair\x00\xff",
+		"public":  publicOnly,
+	}
+
+	for name, contents := range files {
+		filePath := path.Join(dir, name)
+		err := os.WriteFile(filePath, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = KeyOptions{}.Load(filePath)
+		if err == nil {
+			t.Errorf("Loading the %s keyfile did not return an error.", name)
+		} else if !strings.Contains(err.Error(), "corrupt or not a PEM private key") {
+			t.Errorf("Loading the %s keyfile returned an unclear error: %v", name, err)
+		}
+	}
+}
+
+// A keyfile holding only a public key.
+const publicOnly = `-----BEGIN PUBLIC KEY-----
+MIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAN7RtEN+K1uMEGEFcZ3554zhIrB5D
+8Y2rrAdwY8viY6JN8o4qlEUmAct+C7rxdmT/FMv2VGoAU+286hv7xLzATCwBy9nL
+xhFNkrIHIp8bXUHlAyzRNNnp6lrHBsUigY9xUZMaDvwbUVHfzfe9+NPIx1p8Mjy+
+z7oeNshnI2fYr1ocbbo=
+-----END PUBLIC KEY-----
+`
+
+func TestUseKeyPublicBlock(t *testing.T) {
+	dir := t.TempDir()
+
+	privOnly := keys[:strings.Index(keys, "-----BEGIN PUBLIC KEY-----")]
+
+	_, otherPub, err := KeyOptions{Algorithm: AlgoECDSA}.Create(path.Join(dir, "other"))
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+
+	files := map[string]string{
+		"truncated":  privOnly + "-----BEGIN PUBLIC KEY-----\nMIGbMBAGByqGSM49AgEGBSuBBAAj\n",
+		"mismatched": privOnly + otherPub,
+		"not public": privOnly + privOnly,
+	}
+
+	for name, contents := range files {
+		filePath := path.Join(dir, name)
+		err := os.WriteFile(filePath, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = KeyOptions{}.Load(filePath)
+		if err == nil {
+			t.Errorf("Loading the %s keyfile did not return an error.", name)
+		}
+	}
+
+	filePath := path.Join(dir, "good")
+	err = os.WriteFile(filePath, []byte(keys), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, pubKey, err := KeyOptions{}.Load(filePath)
+	if err != nil {
+		t.Fatalf("Error loading a good keyfile: %v", err)
+	}
+	if pubKey != keys[strings.Index(keys, "-----BEGIN PUBLIC KEY-----"):] {
+		t.Errorf("Loaded public key %q does not match the file.", pubKey)
+	}
+
+	// A keyfile whose public key was never written has it derived from the
+	// private key.
+	filePath = path.Join(dir, "private only")
+	err = os.WriteFile(filePath, []byte(privOnly), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, pubKey, err = KeyOptions{}.Load(filePath)
+	if err != nil {
+		t.Fatalf("Error loading a keyfile with only the private key: %v", err)
+	}
+	if pubKey != keys[strings.Index(keys, "-----BEGIN PUBLIC KEY-----"):] {
+		t.Errorf("Derived public key %q does not match the one that was left out.", pubKey)
+	}
+}
+
+// A shortWriter writes only half of what it is given, as if the disk filled up.
+type shortWriter struct {
+	w io.Writer
+}
+
+func (s shortWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p[:len(p)/2])
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "keypair.txt")
+
+	err := WriteFileAtomic(filePath, func(w io.Writer) error {
+		return WriteAll(shortWriter{w}, []byte(keys))
+	})
+	if err != io.ErrShortWrite {
+		t.Errorf("A short write returned %v, expected %v.", err, io.ErrShortWrite)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("A failed write left %d files behind.", len(entries))
+	}
+
+	err = WriteFileAtomic(filePath, func(w io.Writer) error {
+		return WriteAll(w, []byte(keys))
+	})
+	if err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil || string(contents) != keys {
+		t.Errorf("The file does not hold what was written: %v", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("The file has mode %o, expected 600.", info.Mode().Perm())
+	}
+}
+
+func TestWriteFileExclusive(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "keypair.txt")
+
+	err := WriteFileExclusive(filePath, func(w io.Writer) error {
+		return WriteAll(w, []byte(keys))
+	})
+	if err != nil {
+		t.Fatalf("Error writing a new file: %v", err)
+	}
+
+	// A file that is already there is left as it is.
+	err = WriteFileExclusive(filePath, func(w io.Writer) error {
+		return WriteAll(w, []byte("replaced"))
+	})
+	if !os.IsExist(err) {
+		t.Errorf("Writing over a file returned %v, expected it to exist.", err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil || string(contents) != keys {
+		t.Errorf("The file does not hold what was first written: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("The directory holds %d files, expected only the key pair file.", len(entries))
+	}
+}
+
+func TestRemovePending(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "keypair.txt")
+
+	unlock, err := lockFile(filePath + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	// An interrupt while the file is being written removes the lock file and
+	// the temporary file, and the write never lands.
+	err = WriteFileAtomic(filePath, func(w io.Writer) error {
+		RemovePending()
+		return fmt.Errorf("interrupted")
+	})
+	if err == nil {
+		t.Fatal("The interrupted write did not return an error.")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s was left behind.", entry.Name())
+	}
+}
+
+func TestBreakStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := path.Join(dir, "keypair.txt.lock")
+
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another waiter breaks the stale lock and takes a new one before this
+	// one gets to it, so the new lock must be left alone.
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	taken, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breakStaleLock(lockPath, stale)
+
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatalf("The lock taken by the other waiter was removed: %v", err)
+	}
+	if !os.SameFile(info, taken) {
+		t.Error("The lock taken by the other waiter was replaced.")
+	}
+
+	// Once the lock is the stale one, it is removed.
+	breakStaleLock(lockPath, taken)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s was left behind.", entry.Name())
+	}
+}
+
+func TestCreateLockedPassphrase(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+
+	asked := 0
+	options := KeyOptions{
+		Encrypt: true,
+		Passphrase: func(confirm bool) (string, error) {
+			asked++
+			// The passphrase is asked for before the lock is taken.
+			if _, err := os.Stat(filePath + ".lock"); err == nil {
+				t.Error("The passphrase was asked for while holding the lock.")
+			}
+			return "correct horse", nil
+		},
+	}
+
+	if _, _, err := options.LoadOrCreate(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if asked != 1 {
+		t.Errorf("The passphrase was asked for %d times, expected once.", asked)
+	}
+}
+
+func TestUseKeyUnsupported(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := map[string]*pem.Block{
+		"pkcs8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+		"pkcs1": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+	}
+
+	for name, block := range blocks {
+		filePath := path.Join(dir, name)
+		err := os.WriteFile(filePath, pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = KeyOptions{}.Load(filePath)
+		if err == nil {
+			t.Errorf("Loading the %s RSA keyfile did not return an error.", name)
+		} else if !strings.Contains(err.Error(), "contains an RSA key") || !strings.Contains(err.Error(), "keygen --force") {
+			t.Errorf("Loading the %s RSA keyfile returned an unclear error: %v", name, err)
+		}
+	}
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKCS8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OpenSSL's ecparam -genkey writes the curve parameters before the key.
+	params := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08}})
+
+	files := map[string]struct {
+		contents []byte
+		key      crypto.Signer
+	}{
+		"sec1":    {append(params, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...), ecKey},
+		"pkcs8":   {pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8}), ecKey},
+		"ed25519": {pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edPKCS8}), edKey},
+		"keypair": {[]byte(keys), nil},
+	}
+
+	for name, file := range files {
+		filePath := path.Join(dir, name)
+		err := os.WriteFile(filePath, file.contents, 0400)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		privKey, pubKey, err := KeyOptions{}.LoadPrivateKey(filePath)
+		if err != nil {
+			t.Fatalf("Error loading the %s key: %v", name, err)
+		}
+
+		if file.key != nil && !SameKey(privKey.Public(), file.key.Public()) {
+			t.Errorf("The loaded %s key does not match the saved one.", name)
+		}
+
+		embedded, err := ParsePublicKey([]byte(pubKey))
+		if err != nil || !SameKey(embedded, privKey.Public()) {
+			t.Errorf("The %s public key does not match the private key: %v", name, err)
+		}
+	}
+
+	filePath := path.Join(dir, "public")
+	err = os.WriteFile(filePath, []byte(publicOnly), 0400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := (KeyOptions{}).LoadPrivateKey(filePath); err == nil {
+		t.Error("Loading a file with only a public key did not return an error.")
+	}
+}
+
+func TestKeyForms(t *testing.T) {
+	types := map[bool]string{false: "EC PRIVATE KEY", true: "PRIVATE KEY"}
+
+	for pkcs8, blockType := range types {
+		filePath := path.Join(t.TempDir(), "keypair.txt")
+
+		privKey, _, err := KeyOptions{PKCS8: pkcs8}.Create(filePath)
+		if err != nil {
+			t.Fatalf("Error creating key: %v", err)
+		}
+
+		contents, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, _ := pem.Decode(contents)
+		if block == nil || block.Type != blockType {
+			t.Fatalf("The private key was saved as %v, expected %q.", block, blockType)
+		}
+
+		// The label has to match the encoding inside the block.
+		if pkcs8 {
+			_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		} else {
+			_, err = x509.ParseECPrivateKey(block.Bytes)
+		}
+		if err != nil {
+			t.Errorf("The %q block does not hold its form: %v", blockType, err)
+		}
+
+		loaded, _, err := KeyOptions{}.Load(filePath)
+		if err != nil {
+			t.Fatalf("Error loading the %q key: %v", blockType, err)
+		}
+		if !SameKey(loaded.Public(), privKey.Public()) {
+			t.Errorf("The loaded %q key does not match the saved one.", blockType)
+		}
+	}
+}
+
+func TestLegacyLabel(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+
+	// The keys constant is a keyfile from before the label was fixed.
+	err := os.WriteFile(filePath, []byte(keys), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode([]byte(keys))
+	if !LegacyLabel(block) {
+		t.Error("A SEC1 key labeled \"PRIVATE KEY\" is not reported as legacy.")
+	}
+
+	var logged []string
+	opts := KeyOptions{Logf: func(format string, a ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, a...))
+	}}
+
+	privKey, _, err := opts.Load(filePath)
+	if err != nil {
+		t.Fatalf("Error loading a legacy keyfile: %v", err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "EC PRIVATE KEY") {
+		t.Errorf("Loading a legacy keyfile logged %q, expected a note about the label.", logged)
+	}
+
+	// Saving the same key again writes the right label.
+	pemPrivKey, err := MarshalPrivateKey(privKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pemPrivKey.Type != "EC PRIVATE KEY" || LegacyLabel(pemPrivKey) {
+		t.Errorf("The key is saved as %q, expected \"EC PRIVATE KEY\".", pemPrivKey.Type)
+	}
+}
+
+func TestCreatedHook(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "keys.txt")
+
+	var created crypto.Signer
+	o := KeyOptions{Created: func(privKey crypto.Signer) { created = privKey }}
+
+	privKey, _, err := o.LoadOrCreate(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created == nil || !SameKey(created.Public(), privKey.Public()) {
+		t.Fatal("Created was not called with the new key pair.")
+	}
+
+	// Loading the saved key pair creates nothing.
+	created = nil
+	if _, _, err := o.LoadOrCreate(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if created != nil {
+		t.Error("Created was called for a key pair that was only loaded.")
+	}
+}
+
+func TestKeyfileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows files have no permission bits.")
+	}
+	dir := t.TempDir()
+
+	for _, test := range []struct {
+		mode, want os.FileMode
+		allow      bool
+		err        error
+	}{
+		{0, 0600, false, nil},
+		{0640, 0640, false, nil},
+		{0644, 0, false, ErrInsecureMode},
+		{0644, 0644, true, nil},
+		{0400, 0, false, nil},
+	} {
+		filePath := path.Join(dir, fmt.Sprintf("keys-%o-%v.txt", test.mode, test.allow))
+		_, _, err := KeyOptions{Mode: test.mode, AllowInsecureMode: test.allow}.Create(filePath)
+		if test.want == 0 {
+			if err == nil || test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("Saving with mode %04o returned %v.", test.mode, err)
+			}
+			if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+				t.Errorf("A key pair file was written with mode %04o.", test.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Saving with mode %04o failed: %v", test.mode, err)
+		}
+
+		info, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != test.want {
+			t.Errorf("Saving with mode %04o gave a file with mode %04o.", test.mode, info.Mode().Perm())
+		}
+	}
+}
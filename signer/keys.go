@@ -0,0 +1,218 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The key algorithms the tool can sign with.  ECDSA keys use the elliptic curve
+// chosen with --curve, P521 by default, and sign the SHA256 digest of the
+// message.  Ed25519 keys sign the message itself and their signatures are the
+// 64 raw bytes, with no ASN.1.
+const (
+	AlgoECDSA   = "ecdsa"
+	AlgoEd25519 = "ed25519"
+)
+
+// The names of the curves EllipticCurve knows, smallest first.
+var SupportedCurves = []string{"p256", "p384", "p521"}
+
+// The EllipticCurve function takes in the name of a curve as given to --curve
+// and returns the curve, or an error if it is unknown.  An empty name means
+// P521, the curve the tool has always used.
+func EllipticCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "p256":
+		return elliptic.P256(), nil
+	case "p384":
+		return elliptic.P384(), nil
+	case "", "p521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unknown curve %q, please use \"p256\", \"p384\" or \"p521\"", name)
+	}
+}
+
+// The CurveName function takes in an ECDSA public key and returns the name
+// --curve uses for its curve, for example "p521".
+func CurveName(pubKey *ecdsa.PublicKey) string {
+	return "p" + strconv.Itoa(pubKey.Curve.Params().BitSize)
+}
+
+// The KeyDescription function takes in a public key and returns its algorithm
+// and, for ECDSA keys, its curve, for example "ECDSA P-521".
+func KeyDescription(pubKey crypto.PublicKey) string {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pubKey)
+	}
+}
+
+// The GenerateKey function takes in the name of a key algorithm and the name of
+// a curve, as EllipticCurve takes it, and returns a new private key of that
+// kind, or an error if there is one.  An empty algorithm means ECDSA, the
+// algorithm the tool has always used.  The curve must be empty for Ed25519.
+func GenerateKey(algo, curve string) (crypto.Signer, error) {
+	return GenerateKeyFrom(algo, curve, rand.Reader)
+}
+
+// The GenerateKeyFrom function takes in the name of a key algorithm, the name
+// of a curve and a source of random bytes, and returns a new private key as
+// GenerateKey does, with its randomness read from random.  A fixed random
+// source always gives the same Ed25519 key, so tests can check its exact
+// bytes.  Since Go 1.26 ECDSA keys are always made from a secure random source
+// and random is not read.
+func GenerateKeyFrom(algo, curve string, random io.Reader) (crypto.Signer, error) {
+	switch algo {
+	case "", AlgoECDSA:
+		c, err := EllipticCurve(curve)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(c, random)
+	case AlgoEd25519:
+		if curve != "" {
+			return nil, errors.New("--curve can only be used with ECDSA keys")
+		}
+		_, privateKey, err := ed25519.GenerateKey(random)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q, please use %q or %q", algo, AlgoECDSA, AlgoEd25519)
+	}
+}
+
+// The KeyAlgorithm function takes in a private or public key and returns the
+// name of its algorithm, or an empty string if the tool can not use it.  Any
+// other crypto.Signer, such as a key kept in an HSM, has the algorithm of its
+// public key.
+func KeyAlgorithm(key interface{}) string {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return AlgoECDSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return AlgoEd25519
+	case crypto.Signer:
+		return KeyAlgorithm(k.Public())
+	default:
+		return ""
+	}
+}
+
+// The MarshalPrivateKey function takes in a private key and whether to save it
+// in PKCS#8 form, and returns the PEM block it is saved as, or an error if
+// there is one.  ECDSA keys are saved in SEC1 form as an "EC PRIVATE KEY"
+// block unless pkcs8 is true.  Ed25519 keys have no SEC1 form and are always
+// saved in PKCS#8 form, as a "PRIVATE KEY" block.
+func MarshalPrivateKey(privKey crypto.Signer, pkcs8 bool) (*pem.Block, error) {
+	key, ok := privKey.(*ecdsa.PrivateKey)
+	if ok && !pkcs8 {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	}
+
+	if KeyAlgorithm(privKey) == "" {
+		return nil, fmt.Errorf("can not save a %T", privKey)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// The ParsePrivateKey function takes in the PEM block holding a private key and
+// returns the private key, or an error if it is not a key the tool can use.
+// ECDSA keys used to be saved in SEC1 form under the "PRIVATE KEY" type, which
+// is the type of PKCS#8 keys, so for that type PKCS#8 is tried first and SEC1
+// second, and old keyfiles still load.  An "EC PRIVATE KEY" block, as the tool
+// and OpenSSL write now, holds SEC1 only.
+func ParsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%q is not a private key", block.Type)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		privKey, ecErr := x509.ParseECPrivateKey(block.Bytes)
+		if ecErr == nil {
+			return privKey, nil
+		}
+
+		// An RSA key in PKCS#1 form under the wrong type.
+		if _, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes); rsaErr == nil {
+			return nil, &UnsupportedKeyError{Kind: "an RSA"}
+		}
+
+		return nil, errors.New("private key is neither PKCS#8 nor SEC1")
+	}
+
+	privKey, ok := key.(crypto.Signer)
+	if !ok || KeyAlgorithm(privKey) == "" {
+		return nil, &UnsupportedKeyError{Kind: keyKind(key)}
+	}
+
+	return privKey, nil
+}
+
+// The LegacyLabel function takes in the PEM block holding a private key and
+// returns true if it is an ECDSA key in SEC1 form under the "PRIVATE KEY" type,
+// as the tool used to save them, rather than the "EC PRIVATE KEY" type.
+func LegacyLabel(block *pem.Block) bool {
+	if block.Type != "PRIVATE KEY" {
+		return false
+	}
+
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return false
+	}
+
+	_, err := x509.ParseECPrivateKey(block.Bytes)
+	return err == nil
+}
+
+// The UnsupportedKeyError struct is the error for a well formed private key of
+// a kind the tool can not sign with.  Kind names the kind with its article, for
+// example "an RSA".
+type UnsupportedKeyError struct {
+	Kind string
+}
+
+func (e *UnsupportedKeyError) Error() string {
+	return fmt.Sprintf("private key is %s key but an ECDSA or Ed25519 key was expected", e.Kind)
+}
+
+// The keyKind function takes in a private key the tool can not sign with and
+// returns its kind with its article, as UnsupportedKeyError holds it.
+func keyKind(key interface{}) string {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return "an RSA"
+	case *ecdh.PrivateKey:
+		return "an X25519"
+	default:
+		return fmt.Sprintf("a %T", key)
+	}
+}
@@ -0,0 +1,89 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"path"
+	"testing"
+)
+
+func TestCurves(t *testing.T) {
+	for _, name := range []string{"p256", "p384", "p521"} {
+		filePath := path.Join(t.TempDir(), "keypair.txt")
+
+		_, _, err := KeyOptions{Algorithm: AlgoECDSA, Curve: name}.Create(filePath)
+		if err != nil {
+			t.Fatalf("Error creating %s key: %v", name, err)
+		}
+
+		privKey, _, err := KeyOptions{}.Load(filePath)
+		if err != nil {
+			t.Fatalf("Error loading %s key: %v", name, err)
+		}
+
+		if got := CurveName(privKey.Public().(*ecdsa.PublicKey)); got != name {
+			t.Errorf("Loaded a key on %s, expected %s.", got, name)
+		}
+
+		signed, err := sign("Hello", privKey, Options{})
+		if err != nil {
+			t.Fatalf("Error signing with %s key: %v", name, err)
+		}
+
+		valid, err := Verify([]byte(signed), nil, Options{})
+		if err != nil || !valid {
+			t.Errorf("The %s signature does not verify: %v", name, err)
+		}
+	}
+
+	if _, err := GenerateKey(AlgoECDSA, "p224"); err == nil {
+		t.Error("An unknown curve did not return an error.")
+	}
+
+	if _, err := GenerateKey(AlgoEd25519, "p256"); err == nil {
+		t.Error("A curve for an Ed25519 key did not return an error.")
+	}
+}
+
+func TestKeyDescription(t *testing.T) {
+	privKey, _ := keyContents()
+	if d := KeyDescription(&privKey.PublicKey); d != "ECDSA P-521" {
+		t.Errorf("Key is described as %q, expected \"ECDSA P-521\".", d)
+	}
+
+	edPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := KeyDescription(edPub); d != "Ed25519" {
+		t.Errorf("Key is described as %q, expected \"Ed25519\".", d)
+	}
+}
+
+func TestGenerateKeyFrom(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x2a}, ed25519.SeedSize)
+	expected := ed25519.NewKeyFromSeed(seed)
+
+	privKey, err := GenerateKeyFrom(AlgoEd25519, "", bytes.NewReader(seed))
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	if !expected.Equal(privKey) {
+		t.Error("The key is not the one the fixed random source gives.")
+	}
+
+	filePath := path.Join(t.TempDir(), "keypair.txt")
+	o := KeyOptions{Algorithm: AlgoEd25519, Rand: bytes.NewReader(seed)}
+	privKey, _, err = o.Create(filePath)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	if !expected.Equal(privKey) {
+		t.Error("Create did not make the key from the Rand of the KeyOptions.")
+	}
+
+	if _, err := GenerateKeyFrom(AlgoEd25519, "", bytes.NewReader(nil)); err == nil {
+		t.Error("An empty random source did not return an error.")
+	}
+}
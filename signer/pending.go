@@ -0,0 +1,44 @@
+package signer
+
+import (
+	"os"
+	"sync"
+)
+
+// The lock files and temporary files this process has made and not yet
+// removed, so they can still be removed if the process is interrupted while it
+// holds them.
+var pending = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// The addPending function takes in the path of a lock or temporary file this
+// process just made, and notes it for RemovePending.
+func addPending(filePath string) {
+	pending.Lock()
+	defer pending.Unlock()
+	pending.paths[filePath] = true
+}
+
+// The removePending function takes in the path of a file noted by addPending
+// and removes it, forgetting it.
+func removePending(filePath string) {
+	pending.Lock()
+	defer pending.Unlock()
+	os.Remove(filePath)
+	delete(pending.paths, filePath)
+}
+
+// The RemovePending function removes every lock file and temporary file this
+// process holds, for a program that is about to exit on a signal.  A key pair
+// file is only ever written by renaming a complete temporary file into place,
+// so what is left is as it was before or as it is after the write.
+func RemovePending() {
+	pending.Lock()
+	defer pending.Unlock()
+	for filePath := range pending.paths {
+		os.Remove(filePath)
+		delete(pending.paths, filePath)
+	}
+}
@@ -0,0 +1,204 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// The PEM type of a PKCS#8 private key encrypted with a passphrase, as
+// "openssl pkcs8 -topk8" and "openssl genpkey -aes256" write it.
+const PKCS8EncryptedType = "ENCRYPTED PRIVATE KEY"
+
+// The most PBKDF2 iterations an encrypted PKCS#8 key may ask for, so a crafted
+// key can not keep the tool busy for hours.
+const maxPKCS8Iterations = 10000000
+
+// The object identifiers of the PKCS#5 v2 (PBES2) schemes, key derivation
+// functions and ciphers DecryptPKCS8 understands.
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// The encryptedPrivateKeyInfo struct is the ASN.1 EncryptedPrivateKeyInfo of
+// RFC 5208 that an ENCRYPTED PRIVATE KEY block holds.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// The pbes2Params struct is the ASN.1 PBES2-params of RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// The pbkdf2Params struct is the ASN.1 PBKDF2-params of RFC 8018.  A missing
+// PRF means HMAC-SHA1.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// The DecryptPKCS8 function takes in an ENCRYPTED PRIVATE KEY PEM block, as
+// OpenSSL writes it, and the passphrase, and returns a "PRIVATE KEY" PEM block
+// holding the decrypted PKCS#8 key.  Only PBES2 with PBKDF2 and AES-CBC, the
+// scheme OpenSSL has used by default since 1.1.0, is supported.  It returns an
+// error if the block uses another scheme or the passphrase is wrong.
+func DecryptPKCS8(block *pem.Block, passphrase string) (*pem.Block, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(block.Bytes, &info); err != nil || len(rest) != 0 {
+		return nil, errors.New("encrypted private key is not a PKCS#8 EncryptedPrivateKeyInfo")
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("encrypted private key uses scheme %v, only PBES2 is supported; convert it with \"openssl pkcs8 -topk8 -v2 aes-256-cbc\"",
+			info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("encrypted private key has bad PBES2 parameters: %v", err)
+	}
+
+	key, iv, err := pbes2Key(params, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != c.BlockSize() {
+		return nil, fmt.Errorf("encrypted private key IV is %d bytes, expected %d", len(iv), c.BlockSize())
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%c.BlockSize() != 0 {
+		return nil, errors.New("encrypted private key is not a whole number of AES blocks")
+	}
+
+	der := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(der, info.EncryptedData)
+
+	// CBC has no tag, so a wrong passphrase shows as bad padding or as a
+	// result that is not a PKCS#8 key.
+	der, ok := unpad(der, c.BlockSize())
+	if !ok {
+		return nil, errors.New("wrong passphrase for the private key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(der); err != nil {
+		return nil, errors.New("wrong passphrase for the private key")
+	}
+
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// The pbes2Key function takes in the PBES2 parameters of an encrypted private
+// key and the passphrase, and returns the AES key derived from the passphrase
+// with PBKDF2 and the IV, or an error if the parameters are not supported.
+func pbes2Key(params pbes2Params, passphrase string) ([]byte, []byte, error) {
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("encrypted private key uses key derivation %v, only PBKDF2 is supported",
+			params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("encrypted private key has bad PBKDF2 parameters: %v", err)
+	}
+	if kdf.IterationCount <= 0 || kdf.IterationCount > maxPKCS8Iterations {
+		return nil, nil, fmt.Errorf("encrypted private key asks for %d PBKDF2 iterations, at most %d are allowed",
+			kdf.IterationCount, maxPKCS8Iterations)
+	}
+
+	prf, err := pbkdf2PRF(kdf.PRF.Algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, nil, fmt.Errorf("encrypted private key uses cipher %v, only AES-CBC is supported", scheme)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLen {
+		return nil, nil, fmt.Errorf("encrypted private key asks for a %d byte key, the cipher takes %d", kdf.KeyLength, keyLen)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("encrypted private key has a bad IV: %v", err)
+	}
+
+	key, err := pbkdf2.Key(prf, passphrase, kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, iv, nil
+}
+
+// The pbkdf2PRF function takes in the object identifier of the PRF of PBKDF2,
+// empty for the default HMAC-SHA1, and returns the hash HMAC is used with, or
+// an error if it is not supported.
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidHMACSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACSHA224):
+		return sha256.New224, nil
+	case oid.Equal(oidHMACSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("encrypted private key uses PBKDF2 with PRF %v, which is not supported", oid)
+	}
+}
+
+// The unpad function takes in data decrypted with a block cipher and the block
+// size, and returns the data without its PKCS#7 padding, or false if the
+// padding is malformed.
+func unpad(data []byte, blockSize int) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) {
+		return nil, false
+	}
+	if !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, false
+	}
+	return data[:len(data)-n], true
+}
@@ -0,0 +1,199 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// The signature formats --sig-format accepts.  "der-base64" is the ASN.1 DER
+// signature, Base64 encoded, as the tool has always written it.  The raw
+// formats write ECDSA signatures as r and s, each left padded to the byte
+// length of the curve, one after the other, as JOSE (ES512) expects.  Ed25519
+// signatures are raw already and are only encoded differently.
+const (
+	SigFormatDER          = "der-base64"
+	SigFormatRawHex       = "rawhex"
+	SigFormatRawBase64URL = "rawbase64url"
+)
+
+// The text encodings --sig-encoding accepts for the signature bytes.  Hex is
+// lowercase and Base64url has no padding, as JOSE writes it.
+const (
+	SigEncodingBase64    = "base64"
+	SigEncodingBase64URL = "base64url"
+	SigEncodingHex       = "hex"
+)
+
+// The SigFormatName function takes in the name of a signature format as given
+// to --sig-format and returns it with the default filled in.
+func SigFormatName(format string) string {
+	if format == "" {
+		return SigFormatDER
+	}
+	return format
+}
+
+// The CheckSigFormat function takes in the name of a signature format and
+// returns an error if it is not one of the formats above.
+func CheckSigFormat(format string) error {
+	switch SigFormatName(format) {
+	case SigFormatDER, SigFormatRawHex, SigFormatRawBase64URL:
+		return nil
+	default:
+		return fmt.Errorf("unknown signature format %q, please use %q, %q or %q",
+			format, SigFormatDER, SigFormatRawHex, SigFormatRawBase64URL)
+	}
+}
+
+// The SigEncodingName function takes in the name of a signature format and the
+// name of a signature encoding as given to --sig-encoding, and returns the
+// encoding with the default of the format filled in: "base64" for
+// "der-base64", "hex" for "rawhex" and "base64url" for "rawbase64url".
+func SigEncodingName(format, encoding string) string {
+	if encoding != "" {
+		return encoding
+	}
+
+	switch SigFormatName(format) {
+	case SigFormatRawHex:
+		return SigEncodingHex
+	case SigFormatRawBase64URL:
+		return SigEncodingBase64URL
+	default:
+		return SigEncodingBase64
+	}
+}
+
+// The CheckSigEncoding function takes in the name of a signature encoding and
+// returns an error if it is not empty or one of the encodings above.
+func CheckSigEncoding(encoding string) error {
+	switch encoding {
+	case "", SigEncodingBase64, SigEncodingBase64URL, SigEncodingHex:
+		return nil
+	default:
+		return fmt.Errorf("unknown signature encoding %q, please use %q, %q or %q",
+			encoding, SigEncodingHex, SigEncodingBase64, SigEncodingBase64URL)
+	}
+}
+
+// The EncodeSignature function takes in a signature as SignMessage returns it,
+// the public key it verifies under, the name of a signature format and the name
+// of a signature encoding, empty for the default of the format.  It returns
+// the signature written in that format and encoding or an error if there is
+// one.
+func EncodeSignature(sign []byte, pubKey crypto.PublicKey, format, encoding string) (string, error) {
+	if err := CheckSigFormat(format); err != nil {
+		return "", err
+	}
+
+	if SigFormatName(format) != SigFormatDER {
+		raw, err := RawSignature(sign, pubKey)
+		if err != nil {
+			return "", err
+		}
+		sign = raw
+	}
+
+	switch SigEncodingName(format, encoding) {
+	case SigEncodingBase64:
+		return base64.StdEncoding.EncodeToString(sign), nil
+	case SigEncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(sign), nil
+	case SigEncodingHex:
+		return hex.EncodeToString(sign), nil
+	default:
+		return "", CheckSigEncoding(encoding)
+	}
+}
+
+// The DecodeSignature function takes in a signature written by EncodeSignature,
+// the public key it verifies under and the names of its format and encoding.
+// It returns the signature in the form VerifyMessage takes, ASN.1 DER for ECDSA
+// keys, or an error if the signature is not written in the format and
+// encoding.
+func DecodeSignature(encoded string, pubKey crypto.PublicKey, format, encoding string) ([]byte, error) {
+	if err := CheckSigFormat(format); err != nil {
+		return nil, err
+	}
+
+	var (
+		sign []byte
+		err  error
+	)
+
+	encoding = SigEncodingName(format, encoding)
+	switch encoding {
+	case SigEncodingBase64:
+		sign, err = base64.StdEncoding.DecodeString(encoded)
+	case SigEncodingBase64URL:
+		sign, err = base64.RawURLEncoding.DecodeString(encoded)
+	case SigEncodingHex:
+		sign, err = hex.DecodeString(encoded)
+	default:
+		return nil, CheckSigEncoding(encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signature is not %s encoded: %v", encoding, err)
+	}
+
+	if key, ok := pubKey.(*ecdsa.PublicKey); ok && SigFormatName(format) != SigFormatDER {
+		return derSignature(sign, curveSize(key))
+	}
+
+	return sign, nil
+}
+
+// The RawSignature function takes in a signature as SignMessage returns it and
+// the public key it verifies under, and returns the raw form of the signature:
+// r and s each left padded to the byte length of the curve, one after the
+// other, for ECDSA keys, and the signature as it is for Ed25519 keys.  It
+// returns an error if an ECDSA signature is malformed.
+func RawSignature(sign []byte, pubKey crypto.PublicKey) ([]byte, error) {
+	if key, ok := pubKey.(*ecdsa.PublicKey); ok {
+		return rawSignature(sign, curveSize(key))
+	}
+	return sign, nil
+}
+
+// The curveSize function takes in an ECDSA public key and returns the length in
+// bytes of each of r and s in a raw signature for its curve, 66 for P-521.
+func curveSize(pubKey *ecdsa.PublicKey) int {
+	return (pubKey.Curve.Params().BitSize + 7) / 8
+}
+
+// The rawSignature function takes in an ASN.1 DER ECDSA signature and the byte
+// length of the curve, and returns r and s each left padded to that length and
+// concatenated, or an error if the signature is malformed.
+func rawSignature(sign []byte, size int) ([]byte, error) {
+	sig, err := parseECDSASig(sign)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sig.R.Bytes()) > size || len(sig.S.Bytes()) > size {
+		return nil, errors.New("signature does not fit the curve")
+	}
+
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// The derSignature function takes in a raw r||s ECDSA signature and the byte
+// length of the curve, and returns the ASN.1 DER form of the signature, or an
+// error if the signature is not twice the length of the curve.
+func derSignature(raw []byte, size int) ([]byte, error) {
+	if len(raw) != 2*size {
+		return nil, fmt.Errorf("raw signature is %d bytes, expected %d", len(raw), 2*size)
+	}
+
+	r := new(big.Int).SetBytes(raw[:size])
+	s := new(big.Int).SetBytes(raw[size:])
+	return marshalSig(ecdsaSig{r, s})
+}
@@ -0,0 +1,140 @@
+package signer
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSigFormats(t *testing.T) {
+	privKey, _ := keyContents()
+
+	for _, format := range []string{SigFormatDER, SigFormatRawHex, SigFormatRawBase64URL} {
+		signed, err := sign("Hello", privKey, Options{SigFormat: format})
+		if err != nil {
+			t.Fatalf("Error signing message as %s: %v", format, err)
+		}
+
+		var out Output
+
+		err = json.Unmarshal([]byte(signed), &out)
+		if err != nil {
+			t.Fatalf("Error unmarshaling json: %v", err)
+		}
+
+		if format == SigFormatDER && out.SignatureFormat != "" {
+			t.Errorf("The default format was recorded as %q.", out.SignatureFormat)
+		}
+		if format != SigFormatDER && out.SignatureFormat != format {
+			t.Errorf("Recorded format is %q, expected %q.", out.SignatureFormat, format)
+		}
+
+		if format != SigFormatDER {
+			// Without a public key the raw signature is not turned back
+			// into ASN.1, so its length can be checked.
+			raw, err := DecodeSignature(out.Signature, nil, format, "")
+			if err != nil || len(raw) != 132 {
+				t.Errorf("The %s signature is %d bytes, expected 132 for P-521: %v", format, len(raw), err)
+			}
+		}
+
+		valid, err := Verify([]byte(signed), nil, Options{})
+		if err != nil || !valid {
+			t.Errorf("The %s signature does not verify: %v", format, err)
+		}
+	}
+
+	_, edKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSign := ed25519.Sign(edKey, []byte("Hello"))
+
+	encoded, err := EncodeSignature(edSign, edKey.Public(), SigFormatRawHex, "")
+	if err != nil {
+		t.Fatalf("Error encoding Ed25519 signature: %v", err)
+	}
+
+	decoded, err := DecodeSignature(encoded, edKey.Public(), SigFormatRawHex, "")
+	if err != nil || string(decoded) != string(edSign) {
+		t.Errorf("The Ed25519 signature does not survive rawhex: %v", err)
+	}
+
+	if CheckSigFormat("raw") == nil {
+		t.Error("An unknown signature format did not return an error.")
+	}
+}
+
+func TestSigEncodings(t *testing.T) {
+	privKey, _ := keyContents()
+
+	decoders := map[string]func(string) ([]byte, error){
+		SigEncodingHex:       hex.DecodeString,
+		SigEncodingBase64:    base64.StdEncoding.DecodeString,
+		SigEncodingBase64URL: base64.RawURLEncoding.DecodeString,
+	}
+
+	for _, format := range []string{SigFormatDER, SigFormatRawHex, SigFormatRawBase64URL} {
+		for encoding, decode := range decoders {
+			opts := Options{SigFormat: format, SigEncoding: encoding}
+
+			signed, err := sign("Hello", privKey, opts)
+			if err != nil {
+				t.Fatalf("Error signing message as %s in %s: %v", format, encoding, err)
+			}
+
+			var out Output
+
+			err = json.Unmarshal([]byte(signed), &out)
+			if err != nil {
+				t.Fatalf("Error unmarshaling json: %v", err)
+			}
+
+			// Only an encoding other than the one the format names is
+			// recorded.
+			if SigEncodingName(format, out.SignatureEncoding) != encoding {
+				t.Errorf("%s in %s was recorded as encoding %q.", format, encoding, out.SignatureEncoding)
+			}
+			if encoding == SigEncodingName(format, "") && out.SignatureEncoding != "" {
+				t.Errorf("The default encoding of %s was recorded as %q.", format, out.SignatureEncoding)
+			}
+
+			if _, err := decode(out.Signature); err != nil {
+				t.Errorf("The %s signature is not %s encoded: %v", format, encoding, err)
+			}
+			if encoding == SigEncodingHex && out.Signature != strings.ToLower(out.Signature) {
+				t.Errorf("The hex signature is not lowercase: %s", out.Signature)
+			}
+
+			valid, err := Verify([]byte(signed), nil, Options{})
+			if err != nil || !valid {
+				t.Errorf("The %s signature in %s does not verify: %v", format, encoding, err)
+			}
+		}
+	}
+
+	// A signature written in one encoding does not decode as another.
+	signed, err := sign("Hello", privKey, Options{SigEncoding: SigEncodingBase64})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	out.SignatureEncoding = SigEncodingHex
+	if _, err := Verify(marshalOutput(t, out), nil, Options{}); err == nil {
+		t.Error("A Base64 signature claimed to be hex did not return an error.")
+	}
+
+	if CheckSigEncoding("base32") == nil {
+		t.Error("An unknown signature encoding did not return an error.")
+	}
+}
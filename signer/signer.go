@@ -0,0 +1,982 @@
+// Package signer signs messages with an ECDSA or Ed25519 private key kept in a
+// key pair file, and verifies the JSON the signer command writes.  It is the
+// library behind the command, which only adds flags and files around it.
+//
+// A message is signed with a key loaded from, or created at, a key pair file:
+//
+//	privKey, _, err := signer.LoadOrCreateKey(path)
+//	if err != nil {
+//		return err
+//	}
+//	out, err := signer.Sign(message, privKey, signer.Options{})
+//
+// and the JSON form of the output is checked with Verify.  SignContext and
+// GenerateKeyContext take a context, for callers that need to give up on a
+// signature or a new key.
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA384 and SHA512 for HashFunc
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// The Options struct holds the choices that change what gets signed and how
+// it is written out.  The zero value signs the input exactly as the tool always
+// has.
+type Options struct {
+	// AAD is associated data that is bound into the signature but never
+	// written to the output.  A verifier has to supply the same value.
+	AAD string
+
+	// EncodeMessage writes the message Base64 encoded, for binary input.
+	EncodeMessage bool
+
+	// Prehashed means the input is the hex digest of the message, computed
+	// with Hash, and is signed as it is rather than hashed again.  Only ECDSA
+	// keys can sign a digest, and nothing else can be bound into it.
+	Prehashed bool
+
+	// Truncated means the input was cut short to fit a length limit before
+	// it was given to Sign.  It is written to the output but not signed.
+	Truncated bool
+
+	// InputEncoding is the encoding the input is given in, one of "raw",
+	// "hex" or "base64".  Empty means "raw".  A hex or Base64 input is signed
+	// as the bytes it encodes and written out as it was given.
+	InputEncoding string
+
+	// Hash is the name of the hash ECDSA keys sign the digest of, one of
+	// "sha256", "sha384" or "sha512".  Empty means "sha256".
+	Hash string
+
+	// Deterministic makes ECDSA signatures use an RFC 6979 nonce, so signing
+	// the same input with the same key always gives the same signature.
+	Deterministic bool
+
+	// LowS makes ECDSA signatures always have an s in the lower half of the
+	// order of the curve, replacing s with N-s when it is not, so each
+	// signature has only one form.  When verifying it refuses signatures
+	// whose s is in the upper half.
+	LowS bool
+
+	// Nonce is a challenge from the verifier that is signed along with the
+	// message and written to the output, so the signature answers only that
+	// challenge.
+	Nonce string
+
+	// Domain names the application the signature is for, such as
+	// "login.example.com".  It is signed ahead of everything else and written
+	// to the output, and a verifier only accepts the signature for the same
+	// domain, so a signature made for one application can not be replayed to
+	// another.
+	Domain string
+
+	// HMACKey is a secret shared with the verifier.  With it the digest an
+	// ECDSA key signs is the HMAC of the preimage keyed with it rather than
+	// its plain digest, so only someone holding the secret can verify the
+	// signature.  Only its ID, HMACKeyID, is written to the output.
+	HMACKey []byte
+
+	// Salt is a random value, made with NewSalt, that is signed after the
+	// message and written to the output, so signing the same message again
+	// gives a signature of different data.
+	Salt string
+
+	// IssuedAt and ExpiresAt are the times, in seconds since 1970, the
+	// signature was made and stops being valid.  Both are signed along with
+	// the message.  0 means the signature never expires.
+	IssuedAt, ExpiresAt int64
+
+	// SigFormat is the format the signature is written in, one of
+	// "der-base64", "rawhex" or "rawbase64url".  Empty means "der-base64".
+	SigFormat string
+
+	// SigEncoding is the text encoding of the signature bytes, one of "hex",
+	// "base64" or "base64url".  Empty means the encoding SigFormat names.
+	SigEncoding string
+
+	// OmitPubKey leaves the public key out of the output, for verifiers that
+	// already have it.  The output can then only be verified against a
+	// trusted key.
+	OmitPubKey bool
+
+	// OmitKeyInfo leaves the curve and key ID of the public key out of the
+	// output, for the smallest output.
+	OmitKeyInfo bool
+
+	// PubKeyDER writes the public key as its Base64 encoded DER PKIX form,
+	// see PublicKeyDER, instead of in PEM format.
+	PubKeyDER bool
+
+	// Checksum adds the checksum of the output to it, see Output.Checksum.
+	Checksum bool
+
+	// Claims signs the input as a JSON object of claims, which must be in the
+	// canonical form CanonicalClaims gives.  It is signed after claimsTag and
+	// written to the claims field of the output instead of the message.
+	Claims bool
+
+	// Rand is the source of random bytes ECDSA signatures are made with.  Nil
+	// means crypto/rand.Reader.  Since Go 1.26 ECDSA always uses a secure
+	// random source, so only a failing Rand is noticed.
+	Rand io.Reader
+
+	// Timing, if set, is called with how long the digest of the message and
+	// the signature each took, with the stage "digest" or "sign".
+	Timing func(stage string, elapsed time.Duration)
+}
+
+// The timed method takes in the name of a stage and the time it started, and
+// reports how long it took to Timing if it is set.
+func (o Options) timed(stage string, start time.Time) {
+	if o.Timing != nil {
+		o.Timing(stage, time.Since(start))
+	}
+}
+
+// The Output struct is used to hold the strings written out by Sign and provide
+// JSON specific tags for each string.
+type Output struct {
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+	PubKey    string `json:"pubkey,omitempty"`
+
+	// Curve is the curve of the key, for example "P-521" or "Ed25519", and
+	// KeyID is the SHA256 digest of its DER public key, Base64url encoded.
+	// They tell a verifier which key signed without parsing the PEM, but are
+	// not signed.  Both are left out with OmitKeyInfo.
+	Curve string `json:"curve,omitempty"`
+	KeyID string `json:"kid,omitempty"`
+
+	// Hash is the name of the hash the message was digested with before
+	// signing.  It is left out for Ed25519 keys, which sign the message
+	// itself.
+	Hash string `json:"hash,omitempty"`
+
+	// Claims is the JSON object of claims that was signed, in place of the
+	// message, which is then empty.  The signed bytes are its canonical form,
+	// see CanonicalClaims, so it may be indented like the rest of the JSON.
+	Claims json.RawMessage `json:"claims,omitempty"`
+
+	// MessageEncoding is "hex" or "base64" when Message holds hex or Base64
+	// encoded bytes rather than the message itself, and left out otherwise.
+	// The encoded bytes are what was signed.
+	MessageEncoding string `json:"message_encoding,omitempty"`
+
+	// SignatureFormat is "rawhex" or "rawbase64url" when Signature holds a raw
+	// signature, and left out for the default Base64 encoded ASN.1 DER.
+	SignatureFormat string `json:"signature_format,omitempty"`
+
+	// SignatureEncoding is "hex", "base64" or "base64url" when Signature is
+	// encoded other than SignatureFormat says, and left out otherwise.
+	SignatureEncoding string `json:"signature_encoding,omitempty"`
+
+	// Nonce is the challenge signed along with the message, left out if there
+	// is none.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Domain is the domain the signature is bound to, left out if there is
+	// none.
+	Domain string `json:"domain,omitempty"`
+
+	// Salt is the random salt signed after the message, left out if there is
+	// none.
+	Salt string `json:"salt,omitempty"`
+
+	// Prehashed is true when Message is the hex digest that was signed
+	// rather than the message, and left out otherwise.
+	Prehashed bool `json:"prehashed,omitempty"`
+
+	// HMACKeyID is the ID of the HMAC key the digest was keyed with, see
+	// HMACKeyID, left out if the digest is a plain one.
+	HMACKeyID string `json:"hmac_key_id,omitempty"`
+
+	// Truncated is true when Message is the start of a longer message, cut
+	// short to fit a length limit, and left out otherwise.  It is not signed.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// IssuedAt and ExpiresAt are the RFC 3339 times the signature was made
+	// and stops being valid, left out if it never expires.
+	IssuedAt  string `json:"issued_at,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	// Checksum is the hex SHA256 digest of all the other fields, see
+	// Checksum, so a consumer can tell the JSON was corrupted before
+	// verifying it.  It is not signed, and is left out unless the Options
+	// ask for it.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Version is the version of the layout of the JSON, SchemaVersion when it
+	// is written.  It comes last so the JSON still starts as it always has.
+	// JSON written before there was a version has none, which is read as
+	// version 1.
+	Version int `json:"version"`
+}
+
+// SchemaVersion is the version of the layout of the JSON of an Output that
+// this package writes.  Version 1 is the message, signature and public key and
+// the optional fields after them.  Version 2 added the hmac_key_id field, which
+// means the signature is over an HMAC rather than a digest, and the claims
+// field, which takes the place of the message, so a version 1 verifier would
+// check the wrong thing.  It goes up when a change would be misread by a
+// verifier that only knows the older layout.
+const SchemaVersion = 2
+
+// The VerifyResult struct holds the result of verifying a signature and what
+// is known about the key that made it, as the verify command reports it.
+type VerifyResult struct {
+	Valid bool `json:"valid"`
+
+	// KeyID, Algorithm and Curve describe the public key the signature was
+	// checked against, see KeyID, KeyAlgorithm and KeyCurve.
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"algo,omitempty"`
+	Curve     string `json:"curve,omitempty"`
+
+	// IssuedAt is the RFC 3339 time the signature says it was made, left out
+	// if it does not say.
+	IssuedAt string `json:"issued_at,omitempty"`
+
+	// Reason is why a signature is invalid, when there is more to say than
+	// that it does not verify.
+	Reason string `json:"reason,omitempty"`
+}
+
+// The NewVerifyResult function takes in whether a signature verified and the
+// public key it was checked against, and returns the VerifyResult describing
+// them.  The key is left out of the result if it is nil.
+func NewVerifyResult(valid bool, pubKey crypto.PublicKey) VerifyResult {
+	result := VerifyResult{Valid: valid}
+	if pubKey == nil {
+		return result
+	}
+
+	result.KeyID, _ = KeyID(pubKey)
+	result.Algorithm = KeyAlgorithm(pubKey)
+	result.Curve = KeyCurve(pubKey)
+	return result
+}
+
+// The String method returns the result as a sentence for people, for example
+// "Signature valid, signed by P-521 key <kid> at <time>".
+func (r VerifyResult) String() string {
+	if !r.Valid {
+		return "Signature invalid"
+	}
+
+	summary := "Signature valid"
+	if r.KeyID != "" {
+		summary += fmt.Sprintf(", signed by %s key %s", r.Curve, r.KeyID)
+	}
+	if r.IssuedAt != "" {
+		summary += " at " + r.IssuedAt
+	}
+	return summary
+}
+
+// The Sign function takes in the input as a string, the private key and the
+// Options.  It returns the Output holding the input, its signature and the
+// public key in PEM format, or Base64 DER with PubKeyDER, or an error if there
+// is one.
+func Sign(input string, privKey crypto.Signer, opts Options) (Output, error) {
+	publicKeyText := PublicKeyPEM
+	if opts.PubKeyDER {
+		publicKeyText = PublicKeyDER
+	}
+	pubKey, err := publicKeyText(privKey.Public())
+	if err != nil {
+		return Output{}, err
+	}
+
+	if opts.Claims {
+		if err := checkClaims(input, opts); err != nil {
+			return Output{}, err
+		}
+	}
+
+	var sign []byte
+	if opts.Prehashed {
+		// A digest is signed as it is, so nothing else can be bound into it.
+		if opts.AAD != "" || opts.Nonce != "" || opts.Domain != "" || opts.Salt != "" || opts.ExpiresAt != 0 || opts.EncodeMessage ||
+			InputEncodingName(opts.InputEncoding) != InputRaw || len(opts.HMACKey) != 0 {
+			return Output{}, errors.New("a digest is signed on its own, without AAD, a nonce, a salt, an expiry, an input encoding or an HMAC key")
+		}
+
+		digest, err := ParseDigest(input, opts.Hash)
+		if err != nil {
+			return Output{}, err
+		}
+
+		sign, err = SignPrehashed(privKey, digest, opts)
+		if err != nil {
+			return Output{}, err
+		}
+	} else {
+		// A hex or Base64 input is signed as the bytes it encodes.
+		message, err := DecodeMessage(input, opts.InputEncoding)
+		if err != nil {
+			return Output{}, err
+		}
+
+		// Sign the preimage of the message with the private key or return an
+		// error.
+		sign, err = SignMessage(privKey, Preimage(message, opts), opts)
+		if err != nil {
+			return Output{}, err
+		}
+	}
+
+	// Convert the signature to the chosen format, Base64 encoded ASN.1 by
+	// default, and return it as a string
+	encSign, err := EncodeSignature(sign, privKey.Public(), opts.SigFormat, opts.SigEncoding)
+	if err != nil {
+		return Output{}, err
+	}
+
+	// Intialize an output struct and set the fields input string, the Base64
+	// encoded signature string, and the public key (in PEM format) string.
+	var out Output
+	out.Version = SchemaVersion
+	out.Message = input
+	out.Signature = encSign
+	if !opts.OmitPubKey {
+		out.PubKey = pubKey
+	}
+
+	if !opts.OmitKeyInfo {
+		out.Curve = KeyCurve(privKey.Public())
+		out.KeyID, err = KeyID(privKey.Public())
+		if err != nil {
+			return Output{}, err
+		}
+	}
+
+	// The default format and encoding are left out so the output stays as it
+	// always was.
+	if SigFormatName(opts.SigFormat) != SigFormatDER {
+		out.SignatureFormat = opts.SigFormat
+	}
+	if SigEncodingName(opts.SigFormat, opts.SigEncoding) != SigEncodingName(opts.SigFormat, "") {
+		out.SignatureEncoding = opts.SigEncoding
+	}
+
+	// Ed25519 does not hash the message, so the hash is only recorded for
+	// ECDSA keys.
+	if KeyAlgorithm(privKey) == AlgoECDSA {
+		out.Hash = HashName(opts.Hash)
+	}
+
+	// The key is secret, only its ID is written.
+	if len(opts.HMACKey) != 0 {
+		out.HMACKeyID = HMACKeyID(opts.HMACKey)
+	}
+
+	// Encoded input is written as it was given, so the verifier decodes the
+	// same bytes.
+	if InputEncodingName(opts.InputEncoding) != InputRaw {
+		out.MessageEncoding = opts.InputEncoding
+	}
+
+	// Claims are written as the JSON object they are, not as a string.
+	if opts.Claims {
+		out.Claims = json.RawMessage(input)
+		out.Message = ""
+	}
+
+	// Binary input is not valid JSON text, so it is written Base64 encoded.
+	if opts.EncodeMessage {
+		out.Message = base64.StdEncoding.EncodeToString([]byte(input))
+		out.MessageEncoding = "base64"
+	}
+
+	// The nonce and the times are part of the signed preimage as well as the
+	// output.
+	out.Nonce = opts.Nonce
+	out.Domain = opts.Domain
+	out.Salt = opts.Salt
+	out.Prehashed = opts.Prehashed
+	out.Truncated = opts.Truncated
+	if opts.ExpiresAt != 0 {
+		out.IssuedAt = time.Unix(opts.IssuedAt, 0).UTC().Format(time.RFC3339)
+		out.ExpiresAt = time.Unix(opts.ExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	// The checksum covers every other field, so it is worked out last.
+	if opts.Checksum {
+		return addChecksum(out)
+	}
+	return out, nil
+}
+
+// The SignMessage function takes in a private key, a message and the
+// Options and returns the signature of the message, or an error if there is
+// one.  ECDSA keys sign the digest of the message with the chosen hash, see
+// Digest, and Ed25519 keys sign the message itself, ignoring the hash.  The
+// key can be any crypto.Signer whose public key is an ECDSA or Ed25519 key,
+// for example one kept in an HSM, not only a private key held in memory.
+func SignMessage(privKey crypto.Signer, message string, opts Options) ([]byte, error) {
+	switch privKey.Public().(type) {
+	case *ecdsa.PublicKey:
+		start := time.Now()
+		digest, err := Digest(message, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.timed("digest", start)
+
+		return SignPrehashed(privKey, digest, opts)
+	case ed25519.PublicKey:
+		// Ed25519 hashes the message as part of signing it, so there is no
+		// digest to key.
+		if len(opts.HMACKey) != 0 {
+			return nil, errors.New("Ed25519 signs the message itself, an HMAC key can only be used with ECDSA keys")
+		}
+		defer opts.timed("sign", time.Now())
+
+		// Ed25519 signers take the whole message and crypto.Hash(0).
+		return privKey.Sign(randomSource(opts.Rand), []byte(message), crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("can not sign with a %T", privKey)
+	}
+}
+
+// The SignPrehashed function takes in a private key, the digest of a message
+// computed with the hash in the options, and the options, and returns the
+// signature of the digest or an error if there is one.  The digest is signed
+// as it is, deterministically if the options ask for it, and with a low s if
+// they ask for that.  Ed25519 keys hash the whole message themselves, so they
+// can not sign a digest.
+//
+// The digest is signed with the Sign method of the crypto.Signer, so a key
+// that never leaves its hardware works the same as one in memory, and the
+// ASN.1 DER signature it returns is checked before it is used.  Only a key in
+// memory can sign deterministically, since RFC 6979 needs the private scalar.
+func SignPrehashed(privKey crypto.Signer, digest []byte, opts Options) ([]byte, error) {
+	pubKey, ok := privKey.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("a %T can not sign a digest, only ECDSA keys can", privKey)
+	}
+	defer opts.timed("sign", time.Now())
+
+	h, err := HashFunc(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var sign []byte
+	if opts.Deterministic {
+		key, ok := privKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("a %T can not sign deterministically, only an ECDSA key in memory can", privKey)
+		}
+		sign, err = SignDigestDeterministic(digest, h, key)
+	} else {
+		sign, err = privKey.Sign(randomSource(opts.Rand), digest, h)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A signer that is not the crypto/ecdsa one may hand back anything, so
+	// only a strict DER signature is passed on.
+	if _, err := parseECDSASig(sign); err != nil {
+		return nil, fmt.Errorf("the signer returned a malformed signature: %v", err)
+	}
+
+	if !opts.LowS {
+		return sign, nil
+	}
+	return NormalizeLowS(sign, pubKey)
+}
+
+// The NormalizeLowS function takes in an ASN.1 DER ECDSA signature and the
+// public key it verifies under, and returns the signature with s replaced by
+// N-s if s is in the upper half of the order N of the curve.  Both forms
+// verify, so this only makes the bytes of a signature unique.  It returns an
+// error if the signature is malformed.
+func NormalizeLowS(sign []byte, pubKey *ecdsa.PublicKey) ([]byte, error) {
+	sig, err := parseECDSASig(sign)
+	if err != nil {
+		return nil, err
+	}
+
+	n := pubKey.Curve.Params().N
+	if sig.S.Cmp(new(big.Int).Rsh(n, 1)) <= 0 {
+		return sign, nil
+	}
+
+	sig.S = new(big.Int).Sub(n, sig.S)
+	return marshalSig(sig)
+}
+
+// The IsLowS function takes in an ASN.1 DER ECDSA signature and the public key
+// it verifies under, and returns true if its s is in the lower half of the
+// order of the curve, as NormalizeLowS makes it.  A malformed signature is
+// not low-S.
+func IsLowS(sign []byte, pubKey *ecdsa.PublicKey) bool {
+	sig, err := parseECDSASig(sign)
+	if err != nil {
+		return false
+	}
+	return sig.S.Cmp(new(big.Int).Rsh(pubKey.Curve.Params().N, 1)) <= 0
+}
+
+// The ParseDigest function takes in a hex encoded digest and the name of the
+// hash it was computed with, and returns the digest bytes, or an error if the
+// input is not hex or is not the size of that hash.
+func ParseDigest(input, hash string) ([]byte, error) {
+	h, err := HashFunc(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, fmt.Errorf("the digest is not hex: %v", err)
+	}
+
+	if len(digest) != h.Size() {
+		return nil, fmt.Errorf("the digest is %d bytes, a %s digest is %d bytes", len(digest), HashName(hash), h.Size())
+	}
+
+	return digest, nil
+}
+
+// The randomSource function takes in a source of random bytes and returns it,
+// or crypto/rand.Reader if it is nil.
+func randomSource(random io.Reader) io.Reader {
+	if random == nil {
+		return rand.Reader
+	}
+	return random
+}
+
+// The SignDigestDeterministic function takes in a digest as a slice of bytes,
+// the hash that produced the digest, and the ECDSA private key.  It returns the
+// ASN.1 encoded ECDSA signature of the digest, with the nonce derived from the
+// private key and the digest as in RFC 6979 instead of read from random, so the
+// same key and digest always give the same signature.
+func SignDigestDeterministic(digest []byte, hash crypto.Hash, privKey *ecdsa.PrivateKey) ([]byte, error) {
+	// Sign uses RFC 6979 when it is given no random source.
+	return privKey.Sign(nil, digest, hash)
+}
+
+// The encodings --input-encoding accepts for the message.
+const (
+	InputRaw    = "raw"
+	InputHex    = "hex"
+	InputBase64 = "base64"
+)
+
+// The InputEncodingName function takes in the name of an input encoding as
+// given to --input-encoding and returns it with the default filled in.
+func InputEncodingName(encoding string) string {
+	if encoding == "" {
+		return InputRaw
+	}
+	return encoding
+}
+
+// The DecodeMessage function takes in a message as it was given and the name of
+// its encoding, "raw", "hex" or "base64".  It returns the bytes the message
+// encodes as a string, the message itself for "raw", or an error if the
+// message is not written in the encoding or the encoding is unknown.
+func DecodeMessage(message, encoding string) (string, error) {
+	var (
+		decoded []byte
+		err     error
+	)
+
+	switch InputEncodingName(encoding) {
+	case InputRaw:
+		return message, nil
+	case InputHex:
+		decoded, err = hex.DecodeString(message)
+		if err != nil {
+			return "", fmt.Errorf("message is not hex encoded: %v", err)
+		}
+	case InputBase64:
+		decoded, err = base64.StdEncoding.DecodeString(message)
+		if err != nil {
+			return "", fmt.Errorf("message is not Base64 encoded: %v", err)
+		}
+	default:
+		return "", fmt.Errorf("unknown message encoding %q, please use %q, %q or %q",
+			encoding, InputRaw, InputHex, InputBase64)
+	}
+
+	return string(decoded), nil
+}
+
+// The tags of the parts of a preimage.  Every preimage starts with
+// preimageTag, and every part, the message included, starts with a tag of its
+// own, so the preimage of one kind of signature can never be taken for the
+// preimage of another, or for anything else signed with the key.  A change to
+// the encoding gets a new version in preimageTag.
+const (
+	preimageTag = "crypto-sign-challenge preimage v1\x00"
+	messageTag  = "crypto-sign-challenge message v1\x00"
+	aadTag      = "crypto-sign-challenge aad v1\x00"
+	nonceTag    = "crypto-sign-challenge nonce v1\x00"
+	ttlTag      = "crypto-sign-challenge ttl v1\x00"
+	saltTag     = "crypto-sign-challenge salt v1\x00"
+	domainTag   = "crypto-sign-challenge domain v1\x00"
+	claimsTag   = "crypto-sign-challenge claims v1\x00"
+)
+
+// SaltSize is the number of random bytes in a salt made by NewSalt.  The salt
+// is written hex encoded, twice as many characters.
+const SaltSize = 16
+
+// The NewSalt function returns SaltSize random bytes, hex encoded, for the
+// Salt of the Options, or an error if the random source fails.
+func NewSalt() (string, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// The Preimage function takes in the input as a string and the Options and
+// returns the string that is actually hashed and signed.  It always starts
+// with preimageTag, and the input is always put in as messageTag, the length of
+// the input as a 4 byte big endian number and the input, so even a plain
+// message has a preimage no other signature can share.  With associated data
+// that is put after aadTag, the length of the associated data as a 4 byte big
+// endian number and the associated data.  With a nonce that is put after
+// nonceTag, the length of the nonce as a 4 byte big endian number and the
+// nonce.  With a lifetime that is put after ttlTag and the issued and expiry
+// times, each in seconds since 1970 as an 8 byte big endian number, so the
+// times are signed along with the message.  With a domain all of that is put
+// after domainTag, the length of the domain as a 4 byte big endian number and
+// the domain, so the domain always comes right after preimageTag.  A salt is
+// the only thing put after the input: saltTag, the length of the salt as a 4
+// byte big endian number and the hex salt, so the input is followed by its
+// salt.  Claims are signed as claimsTag, the length of the canonical claims as
+// a 4 byte big endian number and the canonical claims, in place of the input
+// and its messageTag.
+//
+// This is the one canonical encoding of everything that is signed: Sign,
+// Verify and every other output format build the preimage here and nowhere
+// else.
+func Preimage(input string, opts Options) string {
+	// Claims have a tag of their own, so they are never taken for a message
+	// that happens to be the same JSON.
+	data := lengthPrefixed(messageTag, input)
+	if opts.Claims {
+		data = lengthPrefixed(claimsTag, input)
+	}
+
+	if opts.Salt != "" {
+		data = data + lengthPrefixed(saltTag, opts.Salt)
+	}
+
+	if opts.AAD != "" {
+		data = lengthPrefixed(aadTag, opts.AAD) + data
+	}
+
+	if opts.Nonce != "" {
+		data = lengthPrefixed(nonceTag, opts.Nonce) + data
+	}
+
+	if opts.ExpiresAt != 0 {
+		var times [16]byte
+		binary.BigEndian.PutUint64(times[:8], uint64(opts.IssuedAt))
+		binary.BigEndian.PutUint64(times[8:], uint64(opts.ExpiresAt))
+
+		data = ttlTag + string(times[:]) + data
+	}
+
+	if opts.Domain != "" {
+		data = lengthPrefixed(domainTag, opts.Domain) + data
+	}
+
+	return preimageTag + data
+}
+
+// The lengthPrefixed function takes in the tag of a part of the preimage and
+// its value, and returns the tag, the length of the value in bytes as a 4 byte
+// big endian number and the value, the way every part but the times is put
+// into the preimage.
+func lengthPrefixed(tag, value string) string {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+
+	return tag + string(length[:]) + value
+}
+
+// The SignedBytes function takes in the input as a string and the Options, and
+// returns the preimage that Sign hashes and signs for it: the input decoded as
+// the InputEncoding of the Options says and put through Preimage.  It returns
+// an error if the input can not be decoded or is a digest to sign as it is.
+func SignedBytes(input string, opts Options) ([]byte, error) {
+	if opts.Prehashed {
+		return nil, errors.New("a digest is signed as it is, it has no preimage")
+	}
+
+	message, err := DecodeMessage(input, opts.InputEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(Preimage(message, opts)), nil
+}
+
+// The HashName function takes in the name of a hash as given to --hash and
+// returns it with the default filled in.
+func HashName(hash string) string {
+	if hash == "" {
+		return "sha256"
+	}
+	return hash
+}
+
+// The names of the hashes HashFunc knows, smallest first.
+var SupportedHashes = []string{"sha256", "sha384", "sha512"}
+
+// The HashFunc function takes in the name of a hash as given to --hash and
+// returns the matching crypto.Hash or an error if the hash is unknown.
+func HashFunc(hash string) (crypto.Hash, error) {
+	switch HashName(hash) {
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha384":
+		return crypto.SHA384, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unknown hash %q, please use \"sha256\", \"sha384\" or \"sha512\"", hash)
+	}
+}
+
+// The JOSEHash function takes in an ECDSA public key and returns the name of
+// the hash JOSE pairs with its curve in RFC 7518: "sha256" for P-256 (ES256),
+// "sha384" for P-384 (ES384) and "sha512" for P-521 (ES512).  It returns an
+// empty string for any other curve.
+func JOSEHash(pubKey *ecdsa.PublicKey) string {
+	switch pubKey.Curve.Params().BitSize {
+	case 256:
+		return "sha256"
+	case 384:
+		return "sha384"
+	case 521:
+		return "sha512"
+	default:
+		return ""
+	}
+}
+
+// The CheckHashCurve function takes in a public key and the name of a hash and
+// returns an error if the key is an ECDSA key whose curve JOSE pairs with
+// another hash.  The signature still verifies, but it is not what a verifier
+// following the standard expects.  Ed25519 keys hash nothing and always pass.
+func CheckHashCurve(pubKey crypto.PublicKey, hash string) error {
+	key, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+
+	want := JOSEHash(key)
+	if want == "" || HashName(hash) == want {
+		return nil
+	}
+
+	return fmt.Errorf("JOSE pairs %s keys with %s, not %s", key.Curve.Params().Name, want, HashName(hash))
+}
+
+// The CheckDigestSize function takes in a public key and the name of a hash and
+// returns an error if the key is an ECDSA key whose curve order has fewer bits
+// than the digest.  ECDSA then signs only the leftmost bits of the digest, as
+// many as the order has, and the rest of the digest is not signed at all.  It
+// also returns an error if the hash is unknown.
+func CheckDigestSize(pubKey crypto.PublicKey, hash string) error {
+	h, err := HashFunc(hash)
+	if err != nil {
+		return err
+	}
+
+	key, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+
+	params := key.Curve.Params()
+	digestBits := 8 * h.Size()
+	orderBits := params.N.BitLen()
+	if digestBits <= orderBits {
+		return nil
+	}
+
+	return fmt.Errorf("a %s digest is %d bits but the order of %s is %d bits, so only the first %d bits of the digest are signed",
+		HashName(hash), digestBits, params.Name, orderBits, orderBits)
+}
+
+// The HashSum function takes in the name of a hash ("sha256", "sha384" or
+// "sha512", empty means "sha256") and the input as a string, and returns the
+// digest of the input or an error if the hash is unknown.
+func HashSum(hash, input string) ([]byte, error) {
+	return HashReader(hash, strings.NewReader(input))
+}
+
+// The HashReader function takes in the name of a hash, as HashSum does, and a
+// reader, and returns the digest of everything read from the reader or an
+// error if there is one.  The reader is hashed in chunks as it is read, so a
+// large file never has to be held in memory.
+func HashReader(hash string, r io.Reader) ([]byte, error) {
+	h, err := HashFunc(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := h.New()
+	if _, err := io.Copy(digest, r); err != nil {
+		return nil, err
+	}
+	return digest.Sum(nil), nil
+}
+
+// The HashFile function takes in the name of a hash, as HashSum does, and the
+// path of a file, and returns the digest of the contents of the file, read in
+// chunks, or an error if there is one.
+func HashFile(hash, filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return HashReader(hash, f)
+}
+
+// The Fingerprint function takes in a public key and returns the hex encoded
+// SHA256 digest of its DER encoded PKIX form, or an error if there is one.  Two
+// keys with the same fingerprint are the same key.
+func Fingerprint(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// The KeyID function takes in a public key and returns its SHA256 digest, as
+// Fingerprint has it, Base64url encoded without padding, as JOSE writes a
+// "kid".  It returns an error if there is one.
+func KeyID(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// The KeyCurve function takes in a public key and returns the name of its
+// curve as JOSE writes it, for example "P-521" for ECDSA keys and "Ed25519" for
+// Ed25519 keys.
+func KeyCurve(pubKey crypto.PublicKey) string {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return ""
+	}
+}
+
+// The PublicKeyPEM function takes in a public key and returns it in PEM format,
+// as a "PUBLIC KEY" block holding its DER encoded PKIX form, or an error if
+// there is one.
+func PublicKeyPEM(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// The PublicKeyDER function takes in a public key and returns its DER encoded
+// PKIX form Base64 encoded, the same bytes as the PEM of PublicKeyPEM without
+// the armor, for binary protocols, or an error if there is one.
+func PublicKeyDER(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// The ecdsaSig struct is used to hold 2 *big.Int so than when a ECDSA signature
+// is created, the 2 returned *big.Int can be stored to verify the signature if
+// needed.  Marshaled with encoding/asn1 it is the DER ECDSA-Sig-Value of RFC
+// 3279 that OpenSSL reads and writes: a SEQUENCE of two minimally encoded
+// INTEGERs, with a leading zero byte when the top bit is set.
+type ecdsaSig struct {
+	R, S *big.Int
+}
+
+// The marshalSig function takes in an ECDSA signature and returns its ASN.1
+// DER encoding, or an error saying the signature could not be marshaled.
+func marshalSig(sig ecdsaSig) ([]byte, error) {
+	der, err := asn1.Marshal(sig)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling signature: %w", err)
+	}
+	return der, nil
+}
+
+// The parseECDSASig function takes in an ASN.1 DER ECDSA signature and returns
+// r and s, or an error if it is not exactly the DER of an ECDSA-Sig-Value with
+// positive r and s.  encoding/asn1 ignores extra elements in the SEQUENCE, so
+// the signature is marshaled again and must give the same bytes.
+func parseECDSASig(sign []byte) (ecdsaSig, error) {
+	var sig ecdsaSig
+
+	rest, err := asn1.Unmarshal(sign, &sig)
+	if err != nil {
+		return ecdsaSig{}, err
+	}
+	if len(rest) != 0 {
+		return ecdsaSig{}, errors.New("signature has trailing bytes")
+	}
+
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 {
+		return ecdsaSig{}, errors.New("signature r and s must be positive")
+	}
+
+	der, err := asn1.Marshal(sig)
+	if err != nil {
+		return ecdsaSig{}, err
+	}
+	if !bytes.Equal(der, sign) {
+		return ecdsaSig{}, errors.New("signature is not DER encoded")
+	}
+
+	return sig, nil
+}
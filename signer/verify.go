@@ -0,0 +1,377 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The Verify function takes in the JSON of an Output as a slice of
+// bytes, a trusted public key and the Options the message was signed with.
+// If the Options have a nonce, the JSON must have been signed with it.
+// It returns whether the signature is valid for the message under the trusted
+// public key, or under the public key embedded in the JSON if the trusted key
+// is nil, or an error if the JSON, the public key or the signature encoding is
+// malformed.  A valid signature that has expired returns false and an error
+// wrapping ErrExpired, and JSON whose checksum is wrong an error wrapping
+// ErrChecksum.
+func Verify(contents []byte, trusted crypto.PublicKey, opts Options) (bool, error) {
+	var out Output
+
+	err := json.Unmarshal(contents, &out)
+	if err != nil {
+		return false, err
+	}
+
+	// A corrupted file is told apart from a bad signature before any key is
+	// parsed.
+	if err := CheckChecksum(contents); err != nil {
+		return false, err
+	}
+
+	pubKey := trusted
+	if pubKey == nil {
+		pubKey, err = EmbeddedPublicKey(contents)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// The curve in the JSON is not signed, but one that is not the curve of
+	// the embedded public key means the JSON was put together by hand.
+	if out.Curve != "" && out.PubKey != "" {
+		embedded, err := EmbeddedPublicKey(contents)
+		if err != nil {
+			return false, err
+		}
+		if curve := KeyCurve(embedded); curve != out.Curve {
+			return false, fmt.Errorf("%w: the JSON says %s but its public key is %s", ErrCurveMismatch, out.Curve, curve)
+		}
+	}
+
+	sign, err := DecodeSignature(out.Signature, pubKey, out.SignatureFormat, out.SignatureEncoding)
+	if err != nil {
+		return false, err
+	}
+
+	if err := CheckSignatureRange(pubKey, sign); err != nil {
+		return false, err
+	}
+	if err := CheckLowS(pubKey, sign, opts); err != nil {
+		return false, err
+	}
+
+	// The hash is part of the signed JSON, not something the verifier chooses.
+	opts.Hash = out.Hash
+	if _, err := HashSum(opts.Hash, ""); err != nil {
+		return false, err
+	}
+
+	// A verifier that sent a challenge only accepts a signature of that
+	// challenge.
+	if opts.Nonce != "" && opts.Nonce != out.Nonce {
+		return false, nil
+	}
+	opts.Nonce = out.Nonce
+
+	// Unlike the nonce, the domain always has to be the verifier's own, so a
+	// signature for another domain, or for none, is never accepted.
+	if opts.Domain != out.Domain {
+		return false, nil
+	}
+
+	// The verifier's HMAC key has to be the one the digest was keyed with, and
+	// a signature with a plain digest is not accepted in place of a keyed one.
+	if out.HMACKeyID != "" && len(opts.HMACKey) == 0 {
+		return false, ErrNeedsHMACKey
+	}
+	if out.HMACKeyID == "" && len(opts.HMACKey) != 0 || out.HMACKeyID != "" && out.HMACKeyID != HMACKeyID(opts.HMACKey) {
+		return false, nil
+	}
+
+	// The salt, like the nonce, is only there to be signed.
+	opts.Salt = out.Salt
+
+	// The times, like the hash, are part of the signed JSON.
+	if out.IssuedAt != "" || out.ExpiresAt != "" {
+		issued, err := time.Parse(time.RFC3339, out.IssuedAt)
+		if err != nil {
+			return false, fmt.Errorf("issued_at is not an RFC 3339 time: %v", err)
+		}
+		expires, err := time.Parse(time.RFC3339, out.ExpiresAt)
+		if err != nil {
+			return false, fmt.Errorf("expires_at is not an RFC 3339 time: %v", err)
+		}
+		opts.IssuedAt = issued.Unix()
+		opts.ExpiresAt = expires.Unix()
+	}
+
+	// Claims are signed in their canonical form, however the JSON around them
+	// is indented, and take the place of the message.
+	opts.Claims = len(out.Claims) != 0
+	if opts.Claims {
+		if out.Message != "" || out.MessageEncoding != "" || out.Prehashed {
+			return false, nil
+		}
+
+		canonical, err := CanonicalClaims(out.Claims)
+		if err != nil {
+			return false, err
+		}
+		out.Message = string(canonical)
+	}
+
+	if out.Prehashed {
+		// Nothing but the digest is signed, so a digest that claims to carry
+		// more than that can not be trusted.
+		if opts.AAD != "" || opts.Nonce != "" || opts.Domain != "" || opts.Salt != "" || opts.ExpiresAt != 0 || out.MessageEncoding != "" || len(opts.HMACKey) != 0 {
+			return false, nil
+		}
+
+		digest, err := ParseDigest(out.Message, out.Hash)
+		if err != nil {
+			return false, err
+		}
+
+		key, ok := pubKey.(*ecdsa.PublicKey)
+		if !ok {
+			return false, fmt.Errorf("a %T can not verify a digest, only ECDSA keys can", pubKey)
+		}
+
+		if !VerifyDigest(key, digest, sign) {
+			return false, nil
+		}
+	} else {
+		message, err := DecodeMessage(out.Message, out.MessageEncoding)
+		if err != nil {
+			return false, err
+		}
+
+		if !VerifyMessage(pubKey, message, opts, sign) {
+			return false, nil
+		}
+	}
+
+	// The times are only trusted once the signature over them has verified.
+	if opts.ExpiresAt != 0 && time.Now().Unix() >= opts.ExpiresAt {
+		return false, fmt.Errorf("%w at %s", ErrExpired, out.ExpiresAt)
+	}
+
+	return true, nil
+}
+
+// The error Verify returns, wrapped, for a signature that was valid but
+// has expired.
+var ErrExpired = errors.New("signature expired")
+
+// The error Verify returns, wrapped, for an ECDSA signature whose r or s is
+// zero or not below the order of the curve.  No signer makes one, so it is a
+// forged or tampered signature rather than merely a wrong one.
+var ErrSignatureRange = errors.New("signature r or s is out of range")
+
+// The error Verify returns for an ECDSA signature whose s is in the upper half
+// of the order of the curve when the Options ask for LowS.
+var ErrHighS = errors.New("signature s is not low, as --low-s requires")
+
+// The error Verify returns, wrapped, for JSON whose curve field is not the
+// curve of its public key.
+var ErrCurveMismatch = errors.New("curve does not match the public key")
+
+// The error EmbeddedPublicKey returns for JSON written without a public key,
+// with OmitPubKey.
+var ErrNoPublicKey = errors.New("signed message has no public key")
+
+// The OutputVersion function takes in the JSON of an Output as a slice of bytes
+// and returns the version of its layout, 1 for JSON written before there was a
+// version, or an error if the JSON is malformed or the version is not a
+// positive number.  A version above SchemaVersion comes from a newer signer,
+// and fields it added are not checked.
+func OutputVersion(contents []byte) (int, error) {
+	var out Output
+
+	err := json.Unmarshal(contents, &out)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only JSON with no version field at all is from before versions.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		return 0, err
+	}
+	if _, ok := fields["version"]; !ok {
+		return 1, nil
+	}
+
+	if out.Version < 1 {
+		return 0, fmt.Errorf("version %d is not a schema version", out.Version)
+	}
+	return out.Version, nil
+}
+
+// The EmbeddedPublicKey function takes in the JSON of an Output as a slice of
+// bytes and returns the public key embedded in it, or an error if there is none
+// or it is malformed.
+func EmbeddedPublicKey(contents []byte) (crypto.PublicKey, error) {
+	var out Output
+
+	err := json.Unmarshal(contents, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if out.PubKey == "" {
+		return nil, ErrNoPublicKey
+	}
+
+	return ParsePublicKey([]byte(out.PubKey))
+}
+
+// The SameKey function takes in two public keys and returns true only if they
+// are the same key.
+func SameKey(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// The ParsePublicKey function takes in a PKIX public key as a slice of bytes,
+// PEM encoded, or DER encoded as it is or Base64 encoded as PublicKeyDER
+// writes it, and returns the public key or an error if it is none of those, is
+// a PEM block other than "PUBLIC KEY" or does not hold an ECDSA or Ed25519
+// public key.
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block != nil {
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("public key is a PEM encoded %s block, not a PUBLIC KEY block", block.Type)
+		}
+		return PublicKeyFromBlock(block)
+	}
+
+	// Without the armor the key is DER, Base64 encoded in text such as the
+	// JSON, or raw in a binary file.
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(pemBytes)))
+	if err != nil {
+		der = pemBytes
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, errors.New("public key is not PEM, Base64 DER or DER encoded")
+	}
+
+	return PublicKeyFromBlock(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// The PublicKeyFromBlock function takes in a PEM block and returns the ECDSA or
+// Ed25519 public key it holds or an error if it does not hold one.
+func PublicKeyFromBlock(block *pem.Block) (crypto.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if KeyAlgorithm(key) == "" {
+		return nil, fmt.Errorf("public key is a %T, not an ECDSA or Ed25519 key", key)
+	}
+
+	return key, nil
+}
+
+// The VerifyMessage function takes in a public key, the message that was
+// signed, the Options it was signed with and the signature.  It rebuilds
+// the preimage the same way Sign does and returns true only if the signature is
+// valid for it.
+func VerifyMessage(pubKey crypto.PublicKey, input string, opts Options, sign []byte) bool {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		digest, err := Digest(Preimage(input, opts), opts)
+		if err != nil {
+			return false
+		}
+		return VerifyDigest(key, digest, sign)
+	case ed25519.PublicKey:
+		if len(opts.HMACKey) != 0 {
+			return false
+		}
+		return ed25519.Verify(key, []byte(Preimage(input, opts)), sign)
+	default:
+		return false
+	}
+}
+
+// The VerifyHashed function takes in a public key, a digest that was already
+// computed and the signature, and returns true only if the signature is valid
+// for the digest: an ECDSA signature of the digest as SignPrehashed makes it,
+// or an Ed25519 signature of the digest bytes as the message.
+func VerifyHashed(pubKey crypto.PublicKey, digest, sign []byte) bool {
+	switch key := pubKey.(type) {
+	case *ecdsa.PublicKey:
+		return VerifyDigest(key, digest, sign)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, digest, sign)
+	default:
+		return false
+	}
+}
+
+// The CheckSignatureRange function takes in a public key and a signature in the
+// form VerifyMessage takes, and returns an error wrapping ErrSignatureRange if
+// the key is an ECDSA key and r or s of the signature is not in [1, N-1], N
+// being the order of the curve.  Other keys, and signatures that are not
+// ASN.1, which fail to verify anyway, return nil.
+func CheckSignatureRange(pubKey crypto.PublicKey, sign []byte) error {
+	key, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+
+	var sig ecdsaSig
+	if _, err := asn1.Unmarshal(sign, &sig); err != nil || sig.R == nil || sig.S == nil {
+		return nil
+	}
+
+	n := key.Curve.Params().N
+	if sig.R.Sign() <= 0 || sig.R.Cmp(n) >= 0 {
+		return fmt.Errorf("%w: r is not between 1 and the order of %s", ErrSignatureRange, key.Curve.Params().Name)
+	}
+	if sig.S.Sign() <= 0 || sig.S.Cmp(n) >= 0 {
+		return fmt.Errorf("%w: s is not between 1 and the order of %s", ErrSignatureRange, key.Curve.Params().Name)
+	}
+
+	return nil
+}
+
+// The CheckLowS function takes in a public key, a signature in the form
+// VerifyMessage takes and the Options to verify with, and returns ErrHighS if
+// the Options ask for LowS, the key is an ECDSA key and s of the signature is
+// in the upper half of the order of the curve.  Otherwise it returns nil.
+func CheckLowS(pubKey crypto.PublicKey, sign []byte, opts Options) error {
+	key, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok || !opts.LowS || IsLowS(sign, key) {
+		return nil
+	}
+	return ErrHighS
+}
+
+// The VerifyDigest function takes in an ECDSA public key, the digest that was
+// signed and the ASN.1 encoded signature.  It returns true only if the
+// signature is a single well formed ASN.1 value and is valid for the digest.
+func VerifyDigest(pubKey *ecdsa.PublicKey, digest, sign []byte) bool {
+	// A signature that is not strict DER, or has anything left over, was not
+	// produced by this tool or OpenSSL, so it is treated the same as a bad
+	// signature.
+	sig, err := parseECDSASig(sign)
+	if err != nil {
+		return false
+	}
+
+	return ecdsa.Verify(pubKey, digest, sig.R, sig.S)
+}
@@ -0,0 +1,839 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const malformedPubKey = `-----BEGIN PUBLIC KEY-----
+bm90IGEgcHVibGljIGtleQ==
+-----END PUBLIC KEY-----
+`
+
+func TestVerifyAAD(t *testing.T) {
+	privKey, _ := keyContents()
+	opts := Options{AAD: "session-1234"}
+
+	signed, err := sign("Hello", privKey, opts)
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	if strings.Contains(signed, opts.AAD) {
+		t.Error("The associated data was written to the output.")
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	decSign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		t.Fatalf("Error decoding signature: %v", err)
+	}
+
+	if !VerifyMessage(&privKey.PublicKey, "Hello", opts, decSign) {
+		t.Error("The signature does not verify with the right associated data.")
+	}
+
+	if VerifyMessage(&privKey.PublicKey, "Hello", Options{AAD: "session-9999"}, decSign) {
+		t.Error("The signature verifies with the wrong associated data.")
+	}
+
+	if VerifyMessage(&privKey.PublicKey, "Hello", Options{}, decSign) {
+		t.Error("The signature verifies without the associated data.")
+	}
+}
+
+func TestVerifyEnvelope(t *testing.T) {
+	privKey, _ := keyContents()
+	signed, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("The signed message does not verify: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	tampered := out
+	tampered.Message = "Goodbye"
+	if valid, _ := Verify(marshalOutput(t, tampered), nil, Options{}); valid {
+		t.Error("A changed message verifies.")
+	}
+
+	// A signature that unmarshals but leaves trailing bytes behind.
+	decSign, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		t.Fatalf("Error decoding signature: %v", err)
+	}
+	trailing := out
+	trailing.Signature = base64.StdEncoding.EncodeToString(append(decSign, 0))
+	if valid, _ := Verify(marshalOutput(t, trailing), nil, Options{}); valid {
+		t.Error("A signature with trailing bytes verifies.")
+	}
+
+	missing := out
+	missing.PubKey = ""
+	if _, err := Verify(marshalOutput(t, missing), nil, Options{}); err == nil {
+		t.Error("A message with no public key did not return an error.")
+	}
+
+	malformed := out
+	malformed.PubKey = malformedPubKey
+	if _, err := Verify(marshalOutput(t, malformed), nil, Options{}); err == nil {
+		t.Error("A message with a malformed public key did not return an error.")
+	}
+
+	notPEM := out
+	notPEM.PubKey = "not a public key"
+	if _, err := Verify(marshalOutput(t, notPEM), nil, Options{}); err == nil {
+		t.Error("A message with a public key that is not PEM did not return an error.")
+	}
+}
+
+func marshalOutput(t *testing.T, out Output) []byte {
+	outJSON, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("Error marshaling json: %v", err)
+	}
+	return outJSON
+}
+
+func TestVerifyBinaryEnvelope(t *testing.T) {
+	privKey, _ := keyContents()
+	binary := string([]byte{0x00, 0xff, 0xfe, '\n', 0x80})
+
+	signed, err := sign(binary, privKey, Options{EncodeMessage: true})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if out.MessageEncoding != "base64" {
+		t.Errorf("Message encoding is %q, expected \"base64\".", out.MessageEncoding)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(out.Message)
+	if err != nil || string(decoded) != binary {
+		t.Errorf("The message does not decode to the signed bytes: %v", err)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("The signed binary message does not verify: %v", err)
+	}
+}
+
+func TestVerifyInputEncoding(t *testing.T) {
+	privKey, _ := keyContents()
+	challenge := string([]byte{0xde, 0xad, 0xbe, 0xef})
+
+	inputs := map[string]string{
+		InputHex:    "DEADbeef",
+		InputBase64: "3q2+7w==",
+	}
+
+	for encoding, input := range inputs {
+		signed, err := sign(input, privKey, Options{InputEncoding: encoding})
+		if err != nil {
+			t.Fatalf("Error signing %s message: %v", encoding, err)
+		}
+
+		var out Output
+
+		err = json.Unmarshal([]byte(signed), &out)
+		if err != nil {
+			t.Fatalf("Error unmarshaling json: %v", err)
+		}
+
+		if out.Message != input || out.MessageEncoding != encoding {
+			t.Errorf("The %s message was written as %q encoded %q.", encoding, out.Message, out.MessageEncoding)
+		}
+
+		decSign, err := base64.StdEncoding.DecodeString(out.Signature)
+		if err != nil {
+			t.Fatalf("Error decoding signature: %v", err)
+		}
+
+		// The decoded bytes are signed, not the text of the encoding.
+		if !VerifyMessage(&privKey.PublicKey, challenge, Options{}, decSign) {
+			t.Errorf("The %s signature does not verify against the decoded bytes.", encoding)
+		}
+
+		valid, err := Verify([]byte(signed), nil, Options{})
+		if err != nil || !valid {
+			t.Errorf("The %s message does not verify: %v", encoding, err)
+		}
+	}
+
+	for encoding, input := range map[string]string{InputHex: "deadbee", InputBase64: "3q2+7w"} {
+		if _, err := sign(input, privKey, Options{InputEncoding: encoding}); err == nil {
+			t.Errorf("The malformed %s message %q did not return an error.", encoding, input)
+		}
+	}
+
+	if _, err := DecodeMessage("Hello", "base32"); err == nil {
+		t.Error("An unknown message encoding did not return an error.")
+	}
+}
+
+func TestVerifyHashes(t *testing.T) {
+	privKey, _ := keyContents()
+
+	for _, hash := range []string{"sha256", "sha384", "sha512"} {
+		signed, err := sign("Hello", privKey, Options{Hash: hash})
+		if err != nil {
+			t.Fatalf("Error signing message with %s: %v", hash, err)
+		}
+
+		var out Output
+
+		err = json.Unmarshal([]byte(signed), &out)
+		if err != nil {
+			t.Fatalf("Error unmarshaling json: %v", err)
+		}
+
+		if out.Hash != hash {
+			t.Errorf("Recorded hash is %q, expected %q.", out.Hash, hash)
+		}
+
+		valid, err := Verify([]byte(signed), nil, Options{})
+		if err != nil || !valid {
+			t.Errorf("The %s signature does not verify: %v", hash, err)
+		}
+
+		// Claiming a different hash than the one used must not verify.
+		out.Hash = "sha256"
+		if hash == "sha256" {
+			out.Hash = "sha512"
+		}
+		if valid, _ := Verify(marshalOutput(t, out), nil, Options{}); valid {
+			t.Errorf("The %s signature verifies as %s.", hash, out.Hash)
+		}
+	}
+
+	_, err := HashSum("md5", "Hello")
+	if err == nil {
+		t.Error("An unknown hash did not return an error.")
+	}
+}
+
+func TestVerifyAgainst(t *testing.T) {
+	privKey, _ := keyContents()
+
+	// Someone else signs with their own key and embeds their own public key.
+	otherKey, _, err := KeyOptions{Algorithm: AlgoECDSA}.Create(path.Join(t.TempDir(), "keypair.txt"))
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+
+	forged, err := sign("Hello", otherKey, Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	valid, err := Verify([]byte(forged), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("The message does not verify against its own public key: %v", err)
+	}
+
+	valid, err = Verify([]byte(forged), &privKey.PublicKey, Options{})
+	if err != nil || valid {
+		t.Errorf("A message signed by another key verifies against the trusted key: %v", err)
+	}
+
+	embedded, err := EmbeddedPublicKey([]byte(forged))
+	if err != nil {
+		t.Fatalf("Error reading embedded public key: %v", err)
+	}
+	if SameKey(embedded, &privKey.PublicKey) {
+		t.Error("Different public keys are reported as the same.")
+	}
+
+	signed, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	valid, err = Verify([]byte(signed), &privKey.PublicKey, Options{})
+	if err != nil || !valid {
+		t.Errorf("The message does not verify against the trusted key: %v", err)
+	}
+
+	embedded, err = EmbeddedPublicKey([]byte(signed))
+	if err != nil {
+		t.Fatalf("Error reading embedded public key: %v", err)
+	}
+	if !SameKey(embedded, &privKey.PublicKey) {
+		t.Error("The same public key is reported as different.")
+	}
+}
+
+func TestVerifyTTL(t *testing.T) {
+	privKey, _ := keyContents()
+	now := time.Now().Unix()
+
+	signed, err := sign("Hello", privKey, Options{IssuedAt: now, ExpiresAt: now + 600})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("A signature that has not expired does not verify: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	// Moving the expiry changes the signed preimage.
+	extended := out
+	extended.ExpiresAt = time.Unix(now+6000, 0).UTC().Format(time.RFC3339)
+	if valid, _ := Verify(marshalOutput(t, extended), nil, Options{}); valid {
+		t.Error("A signature with a changed expiry verifies.")
+	}
+
+	stripped := out
+	stripped.IssuedAt, stripped.ExpiresAt = "", ""
+	if valid, _ := Verify(marshalOutput(t, stripped), nil, Options{}); valid {
+		t.Error("A signature with its times removed verifies.")
+	}
+
+	expired, err := sign("Hello", privKey, Options{IssuedAt: now - 600, ExpiresAt: now - 1})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	valid, err = Verify([]byte(expired), nil, Options{})
+	if valid || !errors.Is(err, ErrExpired) {
+		t.Errorf("An expired signature gave %v, %v, expected it to be rejected as expired.", valid, err)
+	}
+}
+
+func TestVerifyNonce(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, Options{Nonce: "challenge-42"})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if out.Nonce != "challenge-42" {
+		t.Errorf("Recorded nonce is %q, expected \"challenge-42\".", out.Nonce)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{})
+	if err != nil || !valid {
+		t.Errorf("The signature with a nonce does not verify: %v", err)
+	}
+
+	valid, err = Verify([]byte(signed), nil, Options{Nonce: "challenge-42"})
+	if err != nil || !valid {
+		t.Errorf("The signature does not verify against its own challenge: %v", err)
+	}
+
+	if valid, _ := Verify([]byte(signed), nil, Options{Nonce: "challenge-43"}); valid {
+		t.Error("The signature verifies against another challenge.")
+	}
+
+	// Moving bytes between the nonce and the message changes the preimage.
+	moved := out
+	moved.Nonce, moved.Message = "challenge-4", "2Hello"
+	if valid, _ := Verify(marshalOutput(t, moved), nil, Options{}); valid {
+		t.Error("A signature verifies with bytes moved from the nonce to the message.")
+	}
+}
+
+func TestVerifyDomain(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, Options{Domain: "login.example.com"})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out Output
+
+	err = json.Unmarshal([]byte(signed), &out)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if out.Domain != "login.example.com" {
+		t.Errorf("Recorded domain is %q, expected \"login.example.com\".", out.Domain)
+	}
+
+	valid, err := Verify([]byte(signed), nil, Options{Domain: "login.example.com"})
+	if err != nil || !valid {
+		t.Errorf("The signature does not verify for its own domain: %v", err)
+	}
+
+	if valid, _ := Verify([]byte(signed), nil, Options{}); valid {
+		t.Error("The signature with a domain verifies with no domain.")
+	}
+	if valid, _ := Verify([]byte(signed), nil, Options{Domain: "pay.example.com"}); valid {
+		t.Error("The signature verifies for another domain.")
+	}
+
+	// Rewriting the recorded domain does not move the signature to it.
+	moved := out
+	moved.Domain = "pay.example.com"
+	if valid, _ := Verify(marshalOutput(t, moved), nil, Options{Domain: "pay.example.com"}); valid {
+		t.Error("The signature verifies after its domain was rewritten.")
+	}
+
+	// A signature with no domain is not accepted by a verifier that has one.
+	plain, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, _ := Verify([]byte(plain), nil, Options{Domain: "login.example.com"}); valid {
+		t.Error("A signature with no domain verifies for a domain.")
+	}
+
+	// A plain signature over the bytes a domain bound signature covers is not
+	// a domain bound signature.
+	crafted, err := sign(Preimage("Hello", Options{Domain: "login.example.com"}), privKey, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(crafted), &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Message = "Hello"
+	out.Domain = "login.example.com"
+	if valid, _ := Verify(marshalOutput(t, out), nil, Options{Domain: "login.example.com"}); valid {
+		t.Error("A plain signature over a crafted preimage verifies for a domain.")
+	}
+}
+
+func TestVerifyNoPubKey(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, Options{OmitPubKey: true})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	if strings.Contains(signed, `"pubkey"`) {
+		t.Errorf("The public key was written out: %s", signed)
+	}
+
+	if _, err := Verify([]byte(signed), nil, Options{}); !errors.Is(err, ErrNoPublicKey) {
+		t.Errorf("Verifying without a key gave %v, expected %v.", err, ErrNoPublicKey)
+	}
+
+	valid, err := Verify([]byte(signed), &privKey.PublicKey, Options{})
+	if err != nil || !valid {
+		t.Errorf("The message does not verify against the trusted key: %v", err)
+	}
+}
+
+func TestECDSASigDER(t *testing.T) {
+	privKey, _ := keyContents()
+	digest, err := HashSum("sha256", "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, privKey, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An r with the top bit set is written with a leading zero byte, as
+	// OpenSSL writes it, so it is not read as negative.
+	high := new(big.Int).Lsh(big.NewInt(1), 255)
+	der, err := asn1.Marshal(ecdsaSig{high, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(der[2:6], []byte{0x02, 0x21, 0x00, 0x80}) {
+		t.Errorf("An r with the top bit set is encoded as %x, expected a leading zero byte.", der)
+	}
+	if _, err := parseECDSASig(der); err != nil {
+		t.Errorf("A DER signature with a padded r was refused: %v", err)
+	}
+
+	valid, err := asn1.Marshal(ecdsaSig{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyDigest(&privKey.PublicKey, digest, valid) {
+		t.Fatal("A valid DER signature does not verify.")
+	}
+
+	// A third INTEGER, which encoding/asn1 would skip over.
+	extra, _ := asn1.Marshal(struct{ R, S, T *big.Int }{r, s, big.NewInt(1)})
+
+	// r padded with a zero byte it does not need.
+	rBytes := r.Bytes()
+	padded := append([]byte{0x02, byte(len(rBytes) + 1), 0x00}, rBytes...)
+	sDER, _ := asn1.Marshal(s)
+	body := append(padded, sDER...)
+	nonMinimal := append([]byte{0x30, byte(len(body))}, body...)
+
+	// A negative s.
+	negative, _ := asn1.Marshal(ecdsaSig{r, new(big.Int).Neg(s)})
+
+	for name, sign := range map[string][]byte{"extra element": extra, "non-minimal r": nonMinimal, "negative s": negative} {
+		if VerifyDigest(&privKey.PublicKey, digest, sign) {
+			t.Errorf("A signature with a %s verified.", name)
+		}
+		if _, err := rawSignature(sign, curveSize(&privKey.PublicKey)); err == nil {
+			t.Errorf("A signature with a %s was converted to raw.", name)
+		}
+	}
+}
+
+func TestOpenSSLInterop(t *testing.T) {
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is not installed")
+	}
+
+	dir := t.TempDir()
+	msgPath := path.Join(dir, "msg.txt")
+	keyPath := path.Join(dir, "key.pem")
+	pubPath := path.Join(dir, "pub.pem")
+	sigPath := path.Join(dir, "sig.der")
+
+	// OpenSSL signs and verifies the preimage, which is what is hashed.
+	preimage := Preimage("Hello", Options{})
+	if err := os.WriteFile(msgPath, []byte(preimage), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	openssl := func(args ...string) error {
+		out, err := exec.Command(opensslPath, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+		return nil
+	}
+
+	for _, test := range []struct{ curve, hash string }{{"p256", "sha256"}, {"p384", "sha384"}, {"p521", "sha512"}, {"p521", "sha256"}} {
+		privKey, err := GenerateKey(AlgoECDSA, test.curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := MarshalPrivateKey(privKey, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, err := PublicKeyPEM(privKey.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pubPath, []byte(pubKey), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Several signatures each way, so r and s with the top bit set, which
+		// need a leading zero byte, are likely to come up.
+		for i := 0; i < 8; i++ {
+			if err := openssl("dgst", "-"+test.hash, "-sign", keyPath, "-out", sigPath, msgPath); err != nil {
+				t.Fatalf("openssl could not sign: %v", err)
+			}
+			sign, err := os.ReadFile(sigPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMessage(privKey.Public(), "Hello", Options{Hash: test.hash}, sign) {
+				t.Errorf("The %s %s signature from openssl %x does not verify.", test.curve, test.hash, sign)
+			}
+
+			sign, err = SignMessage(privKey, preimage, Options{Hash: test.hash})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(sigPath, sign, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := openssl("dgst", "-"+test.hash, "-verify", pubPath, "-signature", sigPath, msgPath); err != nil {
+				t.Errorf("openssl does not verify the %s %s signature %x: %v", test.curve, test.hash, sign, err)
+			}
+		}
+	}
+}
+
+func TestOutputVersion(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	tests := map[string]int{
+		signed: SchemaVersion,
+		`{"message":"Hello","signature":"","pubkey":""}`:             1,
+		`{"message":"Hello","signature":"","pubkey":"","version":7}`: 7,
+	}
+	for contents, expected := range tests {
+		version, err := OutputVersion([]byte(contents))
+		if err != nil || version != expected {
+			t.Errorf("The version of %s is %d, %v, expected %d.", contents, version, err, expected)
+		}
+	}
+
+	for _, contents := range []string{`{"version":0}`, `{"version":-1}`, `{"version":"1"}`, `not json`} {
+		if _, err := OutputVersion([]byte(contents)); err == nil {
+			t.Errorf("The version of %s was accepted.", contents)
+		}
+	}
+
+	// The version is not signed, so a newer one still verifies.
+	var out Output
+	if err := json.Unmarshal([]byte(signed), &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Version = SchemaVersion + 1
+	if valid, err := Verify(marshalOutput(t, out), nil, Options{}); err != nil || !valid {
+		t.Errorf("A newer version does not verify: %v", err)
+	}
+}
+
+func TestVerifySignatureRange(t *testing.T) {
+	privKey, _ := keyContents()
+
+	out, err := Sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := privKey.Curve.Params().N
+
+	// A zero s, an s above the order of the curve and an r equal to it are
+	// all refused as out of range rather than just failing to verify.
+	bad := map[string]ecdsaSig{
+		"zero s":    {big.NewInt(1), big.NewInt(0)},
+		"s above N": {big.NewInt(1), new(big.Int).Add(n, big.NewInt(1))},
+		"r of N":    {new(big.Int).Set(n), big.NewInt(1)},
+	}
+
+	for name, sig := range bad {
+		der, err := asn1.Marshal(sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forged := out
+		forged.Signature = base64.StdEncoding.EncodeToString(der)
+		forgedJSON, err := json.Marshal(forged)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		valid, err := Verify(forgedJSON, nil, Options{})
+		if valid || !errors.Is(err, ErrSignatureRange) {
+			t.Errorf("The signature with %s verified as %v with error %v, expected ErrSignatureRange.", name, valid, err)
+		}
+	}
+
+	// The curve of the JSON has to be the curve of its public key.
+	forged := out
+	forged.Curve = "P-256"
+	forgedJSON, err := json.Marshal(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := Verify(forgedJSON, nil, Options{}); valid || !errors.Is(err, ErrCurveMismatch) {
+		t.Errorf("JSON with the wrong curve verified as %v with error %v, expected ErrCurveMismatch.", valid, err)
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	// RFC 4231 test case 2.
+	digest, err := Digest("what do ya want for nothing?", Options{HMACKey: []byte("Jefe")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%x", digest) != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("HMAC-SHA256 gave %x.", digest)
+	}
+
+	privKey, _ := keyContents()
+	key := []byte("shared secret")
+
+	signed, err := sign("Hello", privKey, Options{HMACKey: key})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+	if strings.Contains(signed, string(key)) || !strings.Contains(signed, HMACKeyID(key)) {
+		t.Errorf("The output does not hold the key ID, or holds the key: %s", signed)
+	}
+
+	if valid, err := Verify([]byte(signed), nil, Options{HMACKey: key}); !valid || err != nil {
+		t.Errorf("The keyed signature does not verify: %v", err)
+	}
+	if _, err := Verify([]byte(signed), nil, Options{}); !errors.Is(err, ErrNeedsHMACKey) {
+		t.Errorf("Verifying without the key returned %v, expected ErrNeedsHMACKey.", err)
+	}
+	if valid, _ := Verify([]byte(signed), nil, Options{HMACKey: []byte("other secret")}); valid {
+		t.Error("The keyed signature verifies with another key.")
+	}
+
+	plain, err := sign("Hello", privKey, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, _ := Verify([]byte(plain), nil, Options{HMACKey: key}); valid {
+		t.Error("A plain signature verifies as a keyed one.")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, Options{Checksum: true})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+	if !strings.Contains(signed, `"checksum": "`) {
+		t.Fatalf("The output has no checksum: %s", signed)
+	}
+	if valid, err := Verify([]byte(signed), nil, Options{}); !valid || err != nil {
+		t.Errorf("The JSON with a checksum does not verify: %v", err)
+	}
+
+	// Indenting the JSON differently keeps the checksum, but changing a field
+	// does not.
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, []byte(signed)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckChecksum(compacted.Bytes()); err != nil {
+		t.Errorf("The compacted JSON fails its checksum: %v", err)
+	}
+
+	corrupted := strings.Replace(signed, `"sha256"`, `"sha384"`, 1)
+	if err := CheckChecksum([]byte(corrupted)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("The corrupted JSON passes its checksum: %v", err)
+	}
+	if valid, err := Verify([]byte(corrupted), nil, Options{}); valid || !errors.Is(err, ErrChecksum) {
+		t.Errorf("Verifying the corrupted JSON returned %v, %v.", valid, err)
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	canonical, err := CanonicalClaims([]byte(`{"sub": "alice", "iat": 1700000000, "a": {"z": 1.50, "b": [true, null]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"a":{"b":[true,null],"z":1.50},"iat":1700000000,"sub":"alice"}`; string(canonical) != expected {
+		t.Errorf("The canonical claims are %s, expected %s.", canonical, expected)
+	}
+	for _, claims := range []string{``, `{"sub":`, `[1]`, `"alice"`, `null`, `{} {}`} {
+		if _, err := CanonicalClaims([]byte(claims)); err == nil {
+			t.Errorf("The claims %q were accepted.", claims)
+		}
+	}
+
+	privKey, _ := keyContents()
+	if _, err := Sign(`{"sub": "alice"}`, privKey, Options{Claims: true}); err == nil {
+		t.Error("Claims not in canonical form were signed.")
+	}
+
+	// The claims verify however the JSON around them is indented.
+	signed, err := sign(string(canonical), privKey, Options{Claims: true})
+	if err != nil {
+		t.Fatalf("Error signing the claims: %v", err)
+	}
+	if !strings.Contains(signed, `"message": ""`) || !strings.Contains(signed, `"sub": "alice"`) {
+		t.Errorf("The output does not hold the claims in place of the message: %s", signed)
+	}
+	if valid, err := Verify([]byte(signed), nil, Options{}); !valid || err != nil {
+		t.Errorf("The signed claims do not verify: %v", err)
+	}
+
+	for _, tampered := range []string{
+		strings.Replace(signed, `"alice"`, `"bob"`, 1),
+		strings.Replace(signed, `"message": ""`, `"message": "x"`, 1),
+	} {
+		if valid, _ := Verify([]byte(tampered), nil, Options{}); valid {
+			t.Errorf("Tampered claims verify: %s", tampered)
+		}
+	}
+
+	// The same JSON signed as a plain message is not a signature of claims.
+	if Preimage(string(canonical), Options{}) == Preimage(string(canonical), Options{Claims: true}) {
+		t.Error("Claims have the same preimage as a message of the same JSON.")
+	}
+}
+
+func TestParsePublicKeyDER(t *testing.T) {
+	privKey, pubPEM := keyContents()
+
+	derB64, err := PublicKeyDER(privKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := base64.StdEncoding.DecodeString(derB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range map[string]string{"PEM": pubPEM, "Base64 DER": derB64 + "\n", "DER": string(der)} {
+		pubKey, err := ParsePublicKey([]byte(contents))
+		if err != nil || !SameKey(pubKey, privKey.Public()) {
+			t.Errorf("The %s public key did not parse to the key: %v", name, err)
+		}
+	}
+
+	if _, err := ParsePublicKey([]byte("bm90IGEgcHVibGljIGtleQ==")); err == nil {
+		t.Error("Base64 that is not DER parsed as a public key.")
+	}
+
+	// The DER of a public key under another PEM label is not a public key.
+	mislabeled := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if _, err := ParsePublicKey(mislabeled); err == nil || !strings.Contains(err.Error(), "PUBLIC KEY") {
+		t.Errorf("A CERTIFICATE block gave %v, expected it to be refused as not a PUBLIC KEY block.", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The media type written into every bundle.  It is deliberately not one of
+// Sigstore's own media types: these bundles carry no certificate and no
+// transparency log (Rekor) entry, so tooling must never mistake them for a
+// real Sigstore bundle.
+const sigstoreMediaType = "application/vnd.crypto-sign-challenge.bundle+json;version=0.1"
+
+// The digest algorithm names used in bundles, spelled the way Sigstore spells
+// them, by the name given to --hash.
+var sigstoreDigestAlgorithms = map[string]string{
+	"sha256": "SHA2_256",
+	"sha384": "SHA2_384",
+	"sha512": "SHA2_512",
+}
+
+// The sigstoreSign function takes in the input as a string, the public key as a
+// string of PEM format, the private key, and the signer.Options.  It returns
+// a JSON formatted string containing a bundle loosely modeled on a Sigstore
+// bundle (media type, public key, message digest and signature) or an error if
+// there is one.
+func sigstoreSign(input, pubKey string, privKey crypto.Signer, opts signer.Options) (string, error) {
+	// The bundle stores the DER bytes of the public key rather than the PEM
+	// text, so take them out of the PEM block.
+	block, _ := pem.Decode([]byte(pubKey))
+	if block == nil {
+		return "", errors.New("public key is not PEM encoded")
+	}
+
+	// A hex or Base64 input is signed as the bytes it encodes.
+	message, err := signer.DecodeMessage(input, opts.InputEncoding)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := signer.HashSum(opts.Hash, signer.Preimage(message, opts))
+	if err != nil {
+		return "", err
+	}
+
+	sign, err := signer.SignMessage(privKey, signer.Preimage(message, opts), opts)
+	if err != nil {
+		return "", err
+	}
+
+	var b bundle
+	b.MediaType = sigstoreMediaType
+	b.VerificationMaterial.PublicKey.RawBytes = base64.StdEncoding.EncodeToString(block.Bytes)
+	b.MessageSignature.MessageDigest.Algorithm = sigstoreDigestAlgorithms[signer.HashName(opts.Hash)]
+	b.MessageSignature.MessageDigest.Digest = base64.StdEncoding.EncodeToString(digest)
+	b.MessageSignature.Signature = base64.StdEncoding.EncodeToString(sign)
+
+	outJSON, err := marshalJSON(b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(outJSON), nil
+}
+
+// The bundle struct holds the JSON layout of a "sigstore-ish" bundle.  All the
+// byte fields are standard Base64 encoded, as they are in Sigstore.
+type bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial verificationMaterial `json:"verificationMaterial"`
+	MessageSignature     messageSignature     `json:"messageSignature"`
+}
+
+// The verificationMaterial struct holds the DER encoded PKIX public key.
+type verificationMaterial struct {
+	PublicKey struct {
+		RawBytes string `json:"rawBytes"`
+	} `json:"publicKey"`
+}
+
+// The messageSignature struct holds the digest of the message that was signed
+// and the signature of the message.
+type messageSignature struct {
+	MessageDigest struct {
+		Algorithm string `json:"algorithm"`
+		Digest    string `json:"digest"`
+	} `json:"messageDigest"`
+	Signature string `json:"signature"`
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestSigstoreBundle(t *testing.T) {
+	privKey, pubKey := keyContents()
+	signed, err := sigstoreSign("Hello", pubKey, privKey, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var b bundle
+
+	err = json.Unmarshal([]byte(signed), &b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling json: %v", err)
+	}
+
+	if b.MessageSignature.MessageDigest.Algorithm != "SHA2_256" {
+		t.Errorf("Unexpected digest algorithm %q.", b.MessageSignature.MessageDigest.Algorithm)
+	}
+
+	if b.MediaType != sigstoreMediaType {
+		t.Errorf("Unexpected media type %q.", b.MediaType)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(b.VerificationMaterial.PublicKey.RawBytes)
+	if err != nil {
+		t.Fatalf("Error decoding public key: %v", err)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatalf("Error parsing public key: %v", err)
+	}
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("Public key is a %T, not an ECDSA key.", key)
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(b.MessageSignature.MessageDigest.Digest)
+	if err != nil {
+		t.Fatalf("Error decoding digest: %v", err)
+	}
+
+	expected, err := signer.HashSum("sha256", signer.Preimage("Hello", signer.Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(digest, expected) {
+		t.Error("Bundle digest does not match the digest of the preimage of the message.")
+	}
+
+	decSign, err := base64.StdEncoding.DecodeString(b.MessageSignature.Signature)
+	if err != nil {
+		t.Fatalf("Error decoding signature: %v", err)
+	}
+
+	if !signer.VerifyDigest(pub, digest, decSign) {
+		t.Error("The bundle signature is not valid.")
+	}
+}
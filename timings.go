@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The timings flag prints how long each stage of signing took to standard
+// error, to tell a slow home directory from slow crypto.
+var timings = flag.Bool("timings", false, "print how long loading the key, hashing, signing and marshaling took to standard error")
+
+// The stages --timings reports, in the order they happen.
+var timingStages = []string{"key load", "digest", "sign", "marshal"}
+
+// The stageTimes map holds the total time spent in each stage, and stageCounts
+// how many times it ran, for --batch and --count.
+var (
+	stageTimes  = map[string]time.Duration{}
+	stageCounts = map[string]int{}
+)
+
+// The recordStage function takes in the name of a stage and how long it took,
+// and adds it to the times --timings prints.  It is what signer.Options.Timing
+// is set to.
+func recordStage(stage string, elapsed time.Duration) {
+	stageTimes[stage] += elapsed
+	stageCounts[stage]++
+}
+
+// The timeStage function takes in the name of a stage and the time it
+// started, and records how long it took if --timings is given.  It is meant to
+// be deferred at the start of the stage.
+func timeStage(stage string, start time.Time) {
+	if *timings {
+		recordStage(stage, time.Since(start))
+	}
+}
+
+// The writeTimings function takes in a writer and writes one line for each
+// stage that ran: its name, the time spent in it and, if it ran more than
+// once, how many times.
+func writeTimings(w io.Writer) {
+	for _, stage := range timingStages {
+		count := stageCounts[stage]
+		if count == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %v", stage, stageTimes[stage])
+		if count > 1 {
+			fmt.Fprintf(w, " (%d times)", count)
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestTimings(t *testing.T) {
+	defer func() {
+		*timings = false
+		stageTimes = map[string]time.Duration{}
+		stageCounts = map[string]int{}
+	}()
+	*timings = true
+
+	privKey, _ := keyContents()
+	for i := 0; i < 2; i++ {
+		if _, err := sign("Hello", privKey, signer.Options{Timing: recordStage}); err != nil {
+			t.Fatalf("Error signing message: %v", err)
+		}
+	}
+	timeStage("key load", time.Now())
+
+	var buf bytes.Buffer
+	writeTimings(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	expected := []string{"key load: ", "digest: ", "sign: ", "marshal: "}
+	if len(lines) != len(expected) {
+		t.Fatalf("The timings are\n%s\nexpected one line for each of %v.", buf.String(), timingStages)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d of the timings is %q, expected it to start with %q.", i+1, lines[i], prefix)
+		}
+	}
+	if !strings.HasSuffix(lines[2], "(2 times)") {
+		t.Errorf("The sign stage ran twice, but its line is %q.", lines[2])
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The verifyCommand function runs the "verify" subcommand with the arguments
+// that follow it on the command line.  It either checks a signed JSON file
+// written by this tool, many of them with --batch, a signature against a
+// precomputed digest with --hash-file, a detached signature of a file with
+// --file, or that a file is under the signed root of sign-merkle with --merkle
+// and --file.  It prints a summary such as "Signature valid, signed by P-521
+// key <kid>" if the signature verifies and "Signature invalid" (exiting
+// non-zero) if it does not, or the same as JSON with --json.
+func verifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	hashFile := flags.String("hash-file", "", "file holding the hex digest of the signed data, as written by sha256sum")
+	flags.StringVar(file, "file", "", "file the detached signature in --sig was made over")
+	merkleFile := flags.String("merkle", "", "JSON written by sign-merkle, to check the file in --file is under its signed root")
+	sigFile := flags.String("sig", "", "file holding the Base64 encoded signature")
+	pubFile := flags.String("pubkey", "", "file holding the PEM encoded public key")
+	verifyAgainst := flags.String("verify-against", "", "file holding a trusted PEM public key to use instead of the one in the signed JSON")
+	batchMode := flags.Bool("batch", false, "verify every signed JSON file given, and the .json files in every directory given, and print a summary")
+	continueMode := flags.Bool("continue", false, "with --batch, exit 0 even if some files do not verify")
+	jsonMode := flags.Bool("json", false, `print the result as JSON: {"valid":true,"kid":"...","algo":"..."}`)
+	flags.StringVar(hash, "hash", *hash, `hash of the digest in --hash-file, or of the ECDSA signature in --file: "sha256", "sha384" or "sha512"`)
+	flags.StringVar(aad, "aad", "", "associated data the message was signed with")
+	flags.StringVar(aadEnv, "aad-env", "", "name of an environment variable holding the associated data")
+	flags.StringVar(nonce, "nonce", "", "challenge the signed JSON must have been signed with")
+	flags.StringVar(domain, "domain", "", "domain the signature must have been made for")
+	flags.BoolVar(lowS, "low-s", false, "refuse ECDSA signatures whose s is in the upper half of the order of the curve")
+	flags.StringVar(hmacKey, "hmac-key", "", "hex secret the digest was keyed with")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	var result signer.VerifyResult
+
+	if *hashFile != "" && *file != "" {
+		usageError("Please provide either --hash-file or --file, not both.")
+	}
+	if *batchMode && (*hashFile != "" || *file != "") {
+		usageError("--batch verifies signed JSON files, it can not be combined with --hash-file or --file.")
+	}
+	if *merkleFile != "" && (*batchMode || *hashFile != "" || *sigFile != "" || *pubFile != "") {
+		usageError("--merkle can not be combined with --batch, --hash-file, --sig or --pubkey, use --verify-against for a trusted public key.")
+	}
+	if *continueMode && !*batchMode {
+		usageError("--continue can only be used with --batch.")
+	}
+	if *jsonMode && *batchMode {
+		usageError("--json prints the result of one signature, it can not be combined with --batch.")
+	}
+
+	if *batchMode {
+		if flags.NArg() == 0 {
+			usageError("Please provide the signed JSON files, or directories holding them, to verify.")
+		}
+
+		opts, err := optionsFromFlags()
+		checkError(withCode(errCodeArgs, err))
+
+		trusted, err := trustedKey(*verifyAgainst)
+		checkError(err)
+
+		paths, err := batchPaths(flags.Args())
+		checkError(err)
+
+		if !verifyBatch(os.Stdout, paths, trusted, opts) && !*continueMode {
+			os.Exit(exitInvalid)
+		}
+		return
+	} else if *hashFile != "" {
+		if *sigFile == "" || *pubFile == "" || flags.NArg() != 0 {
+			usageError("Please provide --hash-file, --sig and --pubkey.")
+		}
+
+		digest, err := readHashFile(*hashFile, *hash)
+		checkError(err)
+
+		sign, err := readSignatureFile(*sigFile, *hash)
+		checkError(err)
+
+		pubKey, err := readPublicKeyFile(*pubFile)
+		checkError(err)
+
+		result = signer.NewVerifyResult(signer.VerifyHashed(pubKey, digest, sign), pubKey)
+	} else if *merkleFile != "" {
+		if *file == "" || flags.NArg() != 0 {
+			usageError("Please provide --merkle and --file.")
+		}
+
+		trusted, err := trustedKey(*verifyAgainst)
+		checkError(err)
+
+		result, err = verifyMerkle(*merkleFile, *file, trusted)
+		checkError(err)
+	} else if *file != "" {
+		if *sigFile == "" || *pubFile == "" || flags.NArg() != 0 {
+			usageError("Please provide --file, --sig and --pubkey.")
+		}
+
+		opts, err := optionsFromFlags()
+		checkError(withCode(errCodeArgs, err))
+
+		pubKey, err := readPublicKeyFile(*pubFile)
+		checkError(err)
+
+		valid, err := verifyDetached(*file, *sigFile, pubKey, opts)
+		checkError(err)
+
+		result = signer.NewVerifyResult(valid, pubKey)
+	} else {
+		if flags.NArg() != 1 {
+			usageError("Please provide the signed JSON file to verify.")
+		}
+
+		opts, err := optionsFromFlags()
+		checkError(withCode(errCodeArgs, err))
+
+		trusted, err := trustedKey(*verifyAgainst)
+		checkError(err)
+
+		result, err = verifyJSONFile(flags.Arg(0), trusted, opts)
+		if errors.Is(err, errNeedsTrustedKey) {
+			usageError("The signed JSON has no public key, please provide --verify-against.")
+		}
+		if errors.Is(err, signer.ErrNeedsHMACKey) {
+			usageError("The signed JSON was signed with an HMAC key, please provide it with --hmac-key.")
+		}
+		checkError(err)
+	}
+
+	reportResult(result, *jsonMode)
+}
+
+// The errNeedsTrustedKey error is returned by verifyJSONFile for JSON signed
+// with --no-pubkey when no trusted public key is given.
+var errNeedsTrustedKey = errors.New("the signed JSON has no public key, please provide --verify-against")
+
+// The trustedKey function takes in the path given to --verify-against and
+// returns the public key in it, or nil if the path is empty, or an error if
+// the file can not be read.
+func trustedKey(filePath string) (crypto.PublicKey, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+	return readPublicKeyFile(filePath)
+}
+
+// The verifyJSONFile function takes in the path of a signed JSON file, a
+// trusted public key, or nil to use the one in the JSON, and the signer.Options
+// to verify with.  It returns the signer.VerifyResult, valid if the signature
+// verifies, or an error if the file can not be read or parsed.  An expired
+// signature, an ECDSA signature with r or s out of range, or with a high s
+// under --low-s, and JSON whose curve is not the one of its public key or whose
+// checksum is wrong are invalid rather than an error, with the reason in the
+// result and printed to standard error.
+func verifyJSONFile(filePath string, trusted crypto.PublicKey, opts signer.Options) (signer.VerifyResult, error) {
+	valid, contents, err := verifySignedJSON(filePath, trusted, opts)
+
+	// An expired signature, one that is out of range or for another curve, or
+	// corrupted JSON, is invalid rather than an error.
+	var reason string
+	if errors.Is(err, signer.ErrExpired) || errors.Is(err, signer.ErrSignatureRange) || errors.Is(err, signer.ErrCurveMismatch) ||
+		errors.Is(err, signer.ErrHighS) || errors.Is(err, signer.ErrChecksum) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filePath, err)
+		reason, err = err.Error(), nil
+	}
+	if err != nil {
+		return signer.VerifyResult{}, err
+	}
+
+	pubKey := trusted
+	if pubKey == nil {
+		pubKey, err = signer.EmbeddedPublicKey(contents)
+		if err != nil {
+			return signer.VerifyResult{}, err
+		}
+	}
+
+	result := signer.NewVerifyResult(valid, pubKey)
+	result.Reason = reason
+
+	var out signer.Output
+	if err := json.Unmarshal(contents, &out); err != nil {
+		return signer.VerifyResult{}, err
+	}
+	result.IssuedAt = out.IssuedAt
+
+	return result, nil
+}
+
+// The verifySignedJSON function takes in the same arguments as verifyJSONFile
+// and returns true if the signature verifies, and the contents of the file, or
+// an error if there is one.
+func verifySignedJSON(filePath string, trusted crypto.PublicKey, opts signer.Options) (bool, []byte, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// JSON from a newer signer may carry fields this verifier does not know
+	// to check.
+	version, err := signer.OutputVersion(contents)
+	if err != nil {
+		return false, nil, err
+	}
+	if version > signer.SchemaVersion {
+		fmt.Fprintf(os.Stderr, "Warning: %s has schema version %d, this verifier only knows up to version %d, fields added since are not checked.\n",
+			filePath, version, signer.SchemaVersion)
+	}
+
+	// JSON signed with --no-pubkey can only be checked against a key the user
+	// brings.
+	if trusted == nil {
+		if _, err := signer.EmbeddedPublicKey(contents); errors.Is(err, signer.ErrNoPublicKey) {
+			return false, nil, errNeedsTrustedKey
+		}
+	}
+
+	// The public key in the JSON comes from whoever wrote it, so a key the
+	// user already trusts takes its place when one is given.
+	if trusted != nil {
+		embedded, err := signer.EmbeddedPublicKey(contents)
+		if err == nil && !signer.SameKey(embedded, trusted) {
+			fmt.Fprintf(os.Stderr, "Warning: the public key in %s is not the trusted public key.\n", filePath)
+		}
+	}
+
+	valid, err := signer.Verify(contents, trusted, opts)
+	return valid, contents, err
+}
+
+// The reportResult function takes in the signer.VerifyResult of a signature
+// and whether to print it as JSON, and prints it as a summary or as one line of
+// JSON.  If the signature did not verify it then exits the program with the
+// exitInvalid code.
+func reportResult(result signer.VerifyResult, asJSON bool) {
+	if asJSON {
+		checkError(json.NewEncoder(os.Stdout).Encode(result))
+	} else {
+		fmt.Println(result)
+	}
+
+	if !result.Valid {
+		os.Exit(exitInvalid)
+	}
+}
+
+// The verifyDetached function takes in the paths of a file and of its detached
+// signature as --detached writes it, the public key and the signer.Options it
+// was signed with.  It returns true if the signature of the contents of the
+// file verifies under the public key, or an error if either file can not be
+// read or the signature is malformed.
+func verifyDetached(filePath, sigPath string, pubKey crypto.PublicKey, opts signer.Options) (bool, error) {
+	contents, err := readMessageFile(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	sigB64, err := os.ReadFile(sigPath)
+	if err != nil {
+		return false, err
+	}
+
+	return verifyWithKey(pubKey, contents, string(sigB64), opts)
+}
+
+// The verifyFromPEM function takes in a PEM encoded PKIX public key, or its
+// DER, Base64 encoded as --out-der writes it or raw, a message, its Base64
+// encoded signature and the signer.Options it was signed with.  It verifies the
+// signature with nothing but what a verifier is handed, the way any consumer
+// of the tool does.  It returns true if the signature verifies, or an error if
+// the public key or the signature is malformed.
+func verifyFromPEM(pubPEM, message, sigB64 string, opts signer.Options) (bool, error) {
+	pubKey, err := signer.ParsePublicKey([]byte(pubPEM))
+	if err != nil {
+		return false, err
+	}
+
+	return verifyWithKey(pubKey, message, sigB64, opts)
+}
+
+// The verifyWithKey function takes in a public key, a message, its Base64
+// encoded signature, or one armored with --armor, and the signer.Options it was
+// signed with.  It returns true if the signature verifies, or an error if the
+// signature is malformed.
+func verifyWithKey(pubKey crypto.PublicKey, message, sigB64 string, opts signer.Options) (bool, error) {
+	sign, err := decodeSignatureText(sigB64, opts.Hash)
+	if err != nil {
+		return false, err
+	}
+	if err := signer.CheckSignatureRange(pubKey, sign); err != nil {
+		return false, err
+	}
+	if err := signer.CheckLowS(pubKey, sign, opts); err != nil {
+		return false, err
+	}
+
+	return signer.VerifyMessage(pubKey, message, opts, sign), nil
+}
+
+// The readHashFile function takes in the path of a file holding a hex encoded
+// digest, such as the output of sha256sum, and the name of the hash that made
+// it, and returns the digest as a slice of bytes or an error if the hash is
+// unknown or the file does not hold a digest of its size.
+func readHashFile(filePath, hash string) ([]byte, error) {
+	hashFunc, err := signer.HashFunc(hash)
+	if err != nil {
+		return nil, withCode(errCodeArgs, err)
+	}
+
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// sha256sum writes "<digest>  <file name>", so only the first field is the
+	// digest.
+	fields := strings.Fields(string(contents))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s does not contain a digest", filePath)
+	}
+
+	digest, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s does not contain a hex digest: %v", filePath, err)
+	}
+
+	if len(digest) != hashFunc.Size() {
+		return nil, fmt.Errorf("%s holds a %d byte digest, a %s digest is %d bytes",
+			filePath, len(digest), strings.ToUpper(signer.HashName(hash)), hashFunc.Size())
+	}
+
+	return digest, nil
+}
+
+// The readSignatureFile function takes in the path of a file holding a Base64
+// encoded signature, or one armored in a PEM SIGNATURE block, and the name of
+// the hash it was made with, and returns the decoded signature or an error,
+// also if the armor says it was made with another hash.
+func readSignatureFile(filePath, hash string) ([]byte, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSignatureText(string(contents), hash)
+}
+
+// The readPublicKeyFile function takes in the path of a file holding a PEM
+// encoded public key and returns the public key or an error.
+func readPublicKeyFile(filePath string) (crypto.PublicKey, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.ParsePublicKey(contents)
+}
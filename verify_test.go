@@ -0,0 +1,365 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The sha256sum of "Hello" in the format sha256sum writes it.
+const helloHashFile = "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969  hello.txt\n"
+
+func TestVerifyHashFile(t *testing.T) {
+	privKey, pubKey := keyContents()
+	dir := t.TempDir()
+
+	hashFile := path.Join(dir, "hello.txt.sha256")
+	err := os.WriteFile(hashFile, []byte(helloHashFile), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello, err := signer.HashSum("sha256", "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign, err := signer.SignPrehashed(privKey, hello, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	sigFile := path.Join(dir, "hello.sig")
+	err = os.WriteFile(sigFile, []byte(base64.StdEncoding.EncodeToString(sign)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubFile := path.Join(dir, "pub.pem")
+	err = os.WriteFile(pubFile, []byte(pubKey), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := readHashFile(hashFile, "sha256")
+	if err != nil {
+		t.Fatalf("Error reading hash file: %v", err)
+	}
+
+	decSign, err := readSignatureFile(sigFile, "sha256")
+	if err != nil {
+		t.Fatalf("Error reading signature file: %v", err)
+	}
+
+	pub, err := readPublicKeyFile(pubFile)
+	if err != nil {
+		t.Fatalf("Error reading public key file: %v", err)
+	}
+
+	if !signer.VerifyHashed(pub, digest, decSign) {
+		t.Error("The signature does not verify against the hash file.")
+	}
+
+	goodbye, err := signer.HashSum("sha256", "Goodbye")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.VerifyHashed(pub, goodbye, decSign) {
+		t.Error("The signature verifies against the wrong digest.")
+	}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	privKey, pubKey := keyContents()
+	dir := t.TempDir()
+
+	dataFile := path.Join(dir, "data.bin")
+	data := []byte{0x00, 0xff, 'H', 'i', '\n'}
+	err := os.WriteFile(dataFile, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := signer.Options{EncodeMessage: true, AAD: "session-1234"}
+	encSign, err := signatureOnly(string(data), privKey, opts)
+	if err != nil {
+		t.Fatalf("Error signing file: %v", err)
+	}
+
+	sigFile := dataFile + ".sig"
+	err = writeOutput(sigFile, encSign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubFile := path.Join(dir, "pub.pem")
+	err = os.WriteFile(pubFile, []byte(pubKey), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := readPublicKeyFile(pubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := verifyDetached(dataFile, sigFile, pub, opts)
+	if err != nil || !valid {
+		t.Errorf("The detached signature does not verify: %v", err)
+	}
+
+	if valid, _ := verifyDetached(dataFile, sigFile, pub, signer.Options{}); valid {
+		t.Error("The detached signature verifies without its associated data.")
+	}
+
+	err = os.WriteFile(dataFile, append(data, '!'), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, _ := verifyDetached(dataFile, sigFile, pub, opts); valid {
+		t.Error("The detached signature verifies a changed file.")
+	}
+}
+
+func TestVerifyFromPEM(t *testing.T) {
+	ecKey, _ := keyContents()
+	edKey, err := signer.GenerateKey(signer.AlgoEd25519, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, privKey := range []crypto.Signer{ecKey, edKey} {
+		// Only the JSON is kept, as a verifier would get it.
+		signed, err := sign("Hello", privKey, signer.Options{})
+		if err != nil {
+			t.Fatalf("Error signing message: %v", err)
+		}
+
+		var out signer.Output
+		if err := json.Unmarshal([]byte(signed), &out); err != nil {
+			t.Fatalf("Error unmarshaling json: %v", err)
+		}
+
+		valid, err := verifyFromPEM(out.PubKey, out.Message, out.Signature, signer.Options{})
+		if err != nil || !valid {
+			t.Errorf("The %s signature does not verify from the PEM public key: %v", signer.KeyAlgorithm(privKey), err)
+		}
+
+		if valid, _ := verifyFromPEM(out.PubKey, "Goodbye", out.Signature, signer.Options{}); valid {
+			t.Errorf("The %s signature verifies another message.", signer.KeyAlgorithm(privKey))
+		}
+	}
+
+	signed, _ := sign("Hello", ecKey, signer.Options{})
+	var out signer.Output
+	if err := json.Unmarshal([]byte(signed), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifyFromPEM("not a key", out.Message, out.Signature, signer.Options{}); err == nil {
+		t.Error("A public key that is not PEM was accepted.")
+	}
+	if _, err := verifyFromPEM(malformedPubKey, out.Message, out.Signature, signer.Options{}); err == nil {
+		t.Error("A malformed public key was accepted.")
+	}
+	if _, err := verifyFromPEM(out.PubKey, out.Message, "not*base64", signer.Options{}); err == nil {
+		t.Error("A signature that is not Base64 was accepted.")
+	}
+}
+
+func TestVerifyHashFileLength(t *testing.T) {
+	hashFile := path.Join(t.TempDir(), "short.sha256")
+	err := os.WriteFile(hashFile, []byte(hex.EncodeToString(make([]byte, 20))), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readHashFile(hashFile, "sha256")
+	if err == nil {
+		t.Error("A 20 byte digest was accepted as a SHA256 digest.")
+	}
+
+	// The length follows the hash given with --hash.
+	if err := os.WriteFile(hashFile, []byte(hex.EncodeToString(make([]byte, 64))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readHashFile(hashFile, "sha512"); err != nil {
+		t.Errorf("A 64 byte digest was not accepted as a SHA512 digest: %v", err)
+	}
+	if _, err := readHashFile(hashFile, "sha384"); err == nil || !strings.Contains(err.Error(), "SHA384") {
+		t.Errorf("A 64 byte digest given as a SHA384 digest gave %v, expected a length error.", err)
+	}
+	if _, err := readHashFile(hashFile, "md5"); err == nil {
+		t.Error("An unknown hash was accepted.")
+	}
+}
+
+func TestVerifyJSONFileResult(t *testing.T) {
+	privKey, _ := keyContents()
+	dir := t.TempDir()
+
+	issued := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts := signer.Options{IssuedAt: issued.Unix(), ExpiresAt: issued.Add(100 * 365 * 24 * time.Hour).Unix()}
+	out, err := signer.Sign("Hello", privKey, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outJSON, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := path.Join(dir, "signed.json")
+	if err := os.WriteFile(filePath, outJSON, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := verifyJSONFile(filePath, nil, signer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, err := signer.KeyID(privKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := signer.VerifyResult{Valid: true, KeyID: kid, Algorithm: signer.AlgoECDSA, Curve: "P-521", IssuedAt: out.IssuedAt}
+	if result != want {
+		t.Errorf("The result is %+v, expected %+v.", result, want)
+	}
+	if summary := "Signature valid, signed by P-521 key " + kid + " at " + out.IssuedAt; result.String() != summary {
+		t.Errorf("The summary is %q, expected %q.", result, summary)
+	}
+
+	resultJSON, err := json.Marshal(signer.VerifyResult{Valid: false, KeyID: kid, Algorithm: signer.AlgoECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"valid":false,"kid":"` + kid + `","algo":"ecdsa"}`; string(resultJSON) != expected {
+		t.Errorf("The JSON result is %s, expected %s.", resultJSON, expected)
+	}
+}
+
+func TestVerifyFromDER(t *testing.T) {
+	privKey, _ := keyContents()
+
+	signed, err := sign("Hello", privKey, signer.Options{PubKeyDER: true})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	var out signer.Output
+	if err := json.Unmarshal([]byte(signed), &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.PubKey, "BEGIN") {
+		t.Fatalf("The public key is not Base64 DER: %s", out.PubKey)
+	}
+
+	// The JSON verifies with its own key, and the key verifies from the
+	// Base64 and from the raw DER.
+	if result, err := verifyJSONFile(writeTempFile(t, t.TempDir(), signed), nil, signer.Options{}); err != nil || !result.Valid {
+		t.Errorf("The JSON with a DER public key does not verify: %v", err)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(out.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pubKey := range []string{out.PubKey, out.PubKey + "\n", string(der)} {
+		valid, err := verifyFromPEM(pubKey, out.Message, out.Signature, signer.Options{})
+		if err != nil || !valid {
+			t.Errorf("The signature does not verify from the DER public key: %v", err)
+		}
+	}
+}
+
+func TestVerifyNewerVersion(t *testing.T) {
+	privKey, _ := keyContents()
+
+	out, err := signer.Sign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Version = signer.SchemaVersion + 1
+	outJSON, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := path.Join(t.TempDir(), "signed.json")
+	if err := os.WriteFile(filePath, outJSON, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	result, err := verifyJSONFile(filePath, nil, signer.Options{})
+	os.Stderr = stderr
+	w.Close()
+	if err != nil || !result.Valid {
+		t.Errorf("JSON with a newer version does not verify: %v", err)
+	}
+
+	// The fields a newer signer added are not checked, which is warned about.
+	warning, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("schema version %d", signer.SchemaVersion+1); !strings.Contains(string(warning), want) {
+		t.Errorf("The warning is %q, expected it to mention %q.", warning, want)
+	}
+}
+
+func TestVerifyHashFileArmored(t *testing.T) {
+	privKey, _ := keyContents()
+	dir := t.TempDir()
+
+	digest, err := signer.HashSum("sha384", "Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashFile := path.Join(dir, "hello.txt.sha384")
+	if err := os.WriteFile(hashFile, []byte(hex.EncodeToString(digest)+"  hello.txt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sign, err := signer.SignPrehashed(privKey, digest, signer.Options{Hash: "sha384"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigFile := path.Join(dir, "hello.txt.sig")
+	if err := os.WriteFile(sigFile, []byte(armorSignature(sign, privKey.Public(), "sha384")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hash given with --hash is the one the armor is checked against.
+	read, err := readHashFile(hashFile, "sha384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decSign, err := readSignatureFile(sigFile, "sha384")
+	if err != nil {
+		t.Fatalf("The armored sha384 signature was not read: %v", err)
+	}
+	if !signer.VerifyHashed(privKey.Public(), read, decSign) {
+		t.Error("The armored sha384 signature does not verify against the hash file.")
+	}
+
+	if _, err := readSignatureFile(sigFile, "sha256"); err == nil {
+		t.Error("The armored sha384 signature was read as a sha256 one.")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The batchPaths function takes in the arguments of verify --batch, files and
+// directories, and returns the files to verify: each file as it is given, and
+// the .json files directly inside each directory, in name order.  It returns
+// an error if an argument can not be read or there are no files at all, so a
+// mistyped directory does not pass as a corpus with nothing wrong in it.
+func batchPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("there are no signed JSON files to verify")
+	}
+	return paths, nil
+}
+
+// The verifyBatch function takes in a writer, the paths of signed JSON files,
+// a trusted public key, or nil to use the one in each file, and the
+// signer.Options to verify with.  It verifies every file, writing "valid" or
+// "invalid" and its path for each, with the reason for a file that could not
+// be checked, followed by a summary line.  It returns true if every file
+// verified.
+func verifyBatch(w io.Writer, paths []string, trusted crypto.PublicKey, opts signer.Options) bool {
+	valid, invalid := 0, 0
+	for _, filePath := range paths {
+		result, err := verifyJSONFile(filePath, trusted, opts)
+		switch {
+		case err != nil:
+			invalid++
+			fmt.Fprintf(w, "invalid: %s (%v)\n", filePath, err)
+		case !result.Valid:
+			invalid++
+			fmt.Fprintf(w, "invalid: %s\n", filePath)
+		default:
+			valid++
+			fmt.Fprintf(w, "valid: %s\n", filePath)
+		}
+	}
+
+	fmt.Fprintf(w, "%d valid, %d invalid\n", valid, invalid)
+	return invalid == 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	privKey, _ := keyContents()
+	dir := t.TempDir()
+
+	signed, err := sign("Hello", privKey, signer.Options{})
+	if err != nil {
+		t.Fatalf("Error signing message: %v", err)
+	}
+
+	files := map[string]string{
+		"a-good.json":  signed,
+		"b-bad.json":   strings.Replace(signed, `"Hello"`, `"Goodbye"`, 1),
+		"c-junk.json":  "not json",
+		"notes.txt":    "not a signed file",
+		"sub/d.json":   signed,
+		"single.other": signed,
+	}
+	if err := os.Mkdir(path.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the .json files directly inside a directory are picked up, and a
+	// file given by name is used whatever it is called.
+	paths, err := batchPaths([]string{dir, path.Join(dir, "single.other")})
+	if err != nil {
+		t.Fatalf("Error finding the files: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if verifyBatch(&buf, paths, nil, signer.Options{}) {
+		t.Error("The batch verified with a bad file in it.")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		"valid: " + path.Join(dir, "a-good.json"),
+		"invalid: " + path.Join(dir, "b-bad.json"),
+		"invalid: " + path.Join(dir, "c-junk.json") + " (",
+		"valid: " + path.Join(dir, "single.other"),
+		"2 valid, 2 invalid",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("The batch printed\n%s\nexpected %d lines.", buf.String(), len(expected))
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Line %d is %q, expected it to start with %q.", i+1, lines[i], prefix)
+		}
+	}
+
+	buf.Reset()
+	if !verifyBatch(&buf, []string{path.Join(dir, "a-good.json")}, nil, signer.Options{}) {
+		t.Errorf("A batch of good files did not verify:\n%s", buf.String())
+	}
+
+	if _, err := batchPaths([]string{path.Join(dir, "sub", "missing")}); err == nil {
+		t.Error("A missing file was accepted.")
+	}
+	if _, err := batchPaths([]string{t.TempDir()}); err == nil {
+		t.Error("A directory with no signed files was accepted.")
+	}
+}
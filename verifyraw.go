@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The verifyRawCommand function runs the "verify-raw" subcommand with the
+// arguments that follow it on the command line.  It checks a message, its
+// Base64 signature and a PEM public key, each given on its own, with no signed
+// JSON around them.  It prints a summary of the result, "Signature invalid"
+// (exiting non-zero) if the signature does not verify, or the result as JSON
+// with --json.
+func verifyRawCommand(args []string) {
+	flags := flag.NewFlagSet("verify-raw", flag.ExitOnError)
+	message := flags.String("message", "", "the message that was signed")
+	sigB64 := flags.String("sig", "", "the Base64 encoded signature")
+	pubFile := flags.String("pubkey", "", "file holding the PEM encoded public key")
+	jsonMode := flags.Bool("json", false, `print the result as JSON: {"valid":true,"kid":"...","algo":"..."}`)
+	flags.StringVar(hash, "hash", *hash, `hash the ECDSA signature was made with: "sha256", "sha384" or "sha512"`)
+	flags.StringVar(aad, "aad", "", "associated data the message was signed with")
+	flags.StringVar(aadEnv, "aad-env", "", "name of an environment variable holding the associated data")
+	flags.StringVar(nonce, "nonce", "", "challenge the message was signed with")
+	flags.StringVar(domain, "domain", "", "domain the message was signed for")
+	flags.BoolVar(lowS, "low-s", false, "refuse ECDSA signatures whose s is in the upper half of the order of the curve")
+	flags.StringVar(hmacKey, "hmac-key", "", "hex secret the digest was keyed with")
+	flags.BoolVar(debugMode, "debug", *debugMode, "print a stack trace if the program crashes")
+	flags.BoolVar(jsonErrors, "json-errors", *jsonErrors, "write errors to standard error as JSON")
+	flags.Var(&logLevel, "log-level", logLevelUsage)
+	applyConfig(flags)
+	flags.Parse(args)
+
+	// An empty message can be signed with --allow-empty, so it is the flag
+	// being given that counts.
+	messageGiven := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "message" {
+			messageGiven = true
+		}
+	})
+	if !messageGiven || *sigB64 == "" || *pubFile == "" || flags.NArg() != 0 {
+		usageError("Please provide --message, --sig and --pubkey.")
+	}
+
+	opts, err := optionsFromFlags()
+	checkError(withCode(errCodeArgs, err))
+
+	pubKey, err := readPublicKeyFile(*pubFile)
+	checkError(err)
+
+	valid, err := verifyWithKey(pubKey, *message, *sigB64, opts)
+	checkError(err)
+
+	reportResult(signer.NewVerifyResult(valid, pubKey), *jsonMode)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+// The version of this build, set when it is built with
+//
+//	go build -ldflags "-X main.version=1.2.3"
+//
+// and "dev" otherwise.
+var version = "dev"
+
+// The showVersion flag prints the version and build metadata instead of
+// signing.
+var showVersion = flag.Bool("version", false, "print the version, the Go version and the supported algorithms, curves and hashes")
+
+// The versionInfo function returns what --version prints: the version of the
+// build, the commit it was built from if the Go toolchain recorded one, the Go
+// version and platform, and the algorithms, curves and hashes the tool
+// supports, one to a line.  It is meant to be pasted into bug reports.
+func versionInfo() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "crypto-sign-challenge %s\n", version)
+	if commit := buildCommit(); commit != "" {
+		fmt.Fprintf(&b, "commit: %s\n", commit)
+	}
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "algorithms: %s, %s\n", signer.AlgoECDSA, signer.AlgoEd25519)
+	fmt.Fprintf(&b, "curves: %s\n", strings.Join(signer.SupportedCurves, ", "))
+	fmt.Fprintf(&b, "hashes: %s\n", strings.Join(signer.SupportedHashes, ", "))
+
+	return b.String()
+}
+
+// The buildCommit function returns the version control revision the binary was
+// built from, with "-dirty" added if the tree had changes, or an empty string
+// if the Go toolchain did not record one.
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
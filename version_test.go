@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/KiraFox/crypto-sign-challenge/signer"
+)
+
+func TestVersionInfo(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "1.2.3"
+
+	info := versionInfo()
+	for _, expected := range []string{"crypto-sign-challenge 1.2.3\n", runtime.Version(), "ed25519", "p521", "sha512"} {
+		if !strings.Contains(info, expected) {
+			t.Errorf("The version info does not mention %q:\n%s", expected, info)
+		}
+	}
+
+	// Every curve and hash the version lists must be one the tool takes.
+	for _, name := range signer.SupportedCurves {
+		if _, err := signer.EllipticCurve(name); err != nil {
+			t.Errorf("Listed curve %s is not supported: %v", name, err)
+		}
+	}
+	for _, name := range signer.SupportedHashes {
+		if _, err := signer.HashFunc(name); err != nil {
+			t.Errorf("Listed hash %s is not supported: %v", name, err)
+		}
+	}
+}